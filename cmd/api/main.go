@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"pwa/internal/middleware"
+	"pwa/pkg/jwt"
+	"pwa/pkg/mailer"
 	"pwa/pkg/mongodb"
+	"pwa/pkg/oidc"
+	"pwa/pkg/passwordhash"
+	"pwa/pkg/passwordpolicy"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"pwa/internal/handlers"
+	"pwa/internal/models"
 	"pwa/internal/repository"
+	"pwa/internal/service"
 )
 
 func main() {
@@ -21,10 +32,14 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	setupKeyring()
 	mongoClient := setupMongoClient()
+	mail := setupMailer()
+	policy := setupPasswordPolicy()
+	setupPasswordHasher()
 
 	router := setupRouter()
-	setupRoutes(router, mongoClient)
+	setupRoutes(router, mongoClient, mail, policy)
 	configureCORS(router)
 
 	if err := router.Run(":8080"); err != nil {
@@ -45,11 +60,27 @@ func setupMongoClient() *mongo.Client {
 	return mongoClient
 }
 
+func setupKeyring() {
+	keyring, err := jwt.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	jwt.SetDefaultKeyring(keyring)
+}
+
+func setupMailer() mailer.Mailer {
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+	return mail
+}
+
 func configureCORS(router *gin.Engine) {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-Device-Name"}
 	router.Use(cors.New(config))
 }
 
@@ -66,55 +97,305 @@ func setupRouter() *gin.Engine {
 	return router
 }
 
-func setupRoutes(router *gin.Engine, client *mongo.Client) {
+// setupWebAuthnHandler returns nil, disabling passkeys, when no relying
+// party is configured.
+func setupWebAuthnHandler(client *mongo.Client, userRepo *repository.UserRepository, tokenService *service.TokenService) *handlers.WebAuthnHandler {
+	config, err := service.WebAuthnConfigFromEnv()
+	if err != nil {
+		log.Printf("Passkey login disabled: %v", err)
+		return nil
+	}
+
+	challengeRepo := &repository.WebAuthnChallengeRepository{Collection: client.Database("pwa").Collection("webauthnChallenges")}
+	webAuthnService, err := service.NewWebAuthnService(config, userRepo, challengeRepo)
+	if err != nil {
+		log.Fatalf("Failed to configure WebAuthn: %v", err)
+	}
+	return handlers.NewWebAuthnHandler(userRepo, webAuthnService, tokenService)
+}
+
+// setupOIDCHandler returns nil, disabling single sign-on, when no identity
+// provider is configured.
+func setupOIDCHandler(client *mongo.Client, userRepo *repository.UserRepository, tokenService *service.TokenService, registration *service.RegistrationService, loginGuard *service.LoginGuard) *handlers.OIDCHandler {
+	config, err := service.OIDCConfigFromEnv()
+	if err != nil {
+		log.Printf("OpenID Connect login disabled: %v", err)
+		return nil
+	}
+
+	stateRepo := &repository.OIDCStateRepository{Collection: client.Database("pwa").Collection("oidcStates")}
+	oidcService := service.NewOIDCService(oidc.NewProvider(config), userRepo, stateRepo, registration)
+	return handlers.NewOIDCHandler(oidcService, tokenService, loginGuard)
+}
+
+func setupPasswordPolicy() *passwordpolicy.Policy {
+	policy, err := passwordpolicy.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure password policy: %v", err)
+	}
+	return policy
+}
+
+func setupPasswordHasher() {
+	params, err := passwordhash.ParamsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure password hashing: %v", err)
+	}
+	passwordhash.SetDefault(passwordhash.New(params))
+}
+
+func setupDataExportRepository(client *mongo.Client) *repository.DataExportRepository {
+	db := client.Database("pwa")
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName("dataExports"))
+	if err != nil {
+		log.Fatalf("Failed to set up export storage: %v", err)
+	}
+	return &repository.DataExportRepository{Collection: db.Collection("dataExports"), Files: bucket}
+}
+
+func setupRegistrationService(client *mongo.Client, channelRepo *repository.ChannelRepository) *service.RegistrationService {
+	mode, err := service.RegistrationModeFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure registration: %v", err)
+	}
+	inviteRepo := &repository.InviteCodeRepository{Collection: client.Database("pwa").Collection("inviteCodes")}
+	return service.NewRegistrationService(mode, inviteRepo, channelRepo)
+}
+
+func setupChannelLifecycleService(client *mongo.Client, channelRepo *repository.ChannelRepository, todoListRepo *repository.TodoListRepository) *service.ChannelLifecycleService {
+	policy, err := service.EmptyChannelPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure channels: %v", err)
+	}
+	return service.NewChannelLifecycleService(client, policy, channelRepo, todoListRepo)
+}
+
+// setupWebPushService returns nil, disabling push notifications, when no
+// VAPID keys are configured.
+func setupWebPushService(repo *repository.WebPushRepository, channelRepo *repository.ChannelRepository) *service.WebPushService {
+	if os.Getenv("VAPID_PUBLIC_KEY") == "" || os.Getenv("VAPID_PRIVATE_KEY") == "" {
+		log.Printf("Push notifications disabled: VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY must be set")
+		return nil
+	}
+	return service.NewWebPushService(repo, channelRepo)
+}
+
+func setupAvatarRepository(client *mongo.Client) *repository.AvatarRepository {
+	bucket, err := gridfs.NewBucket(client.Database("pwa"), options.GridFSBucket().SetName("avatars"))
+	if err != nil {
+		log.Fatalf("Failed to set up avatar storage: %v", err)
+	}
+	return &repository.AvatarRepository{Files: bucket}
+}
+
+// impersonationReadOnlyRoutes are the only authenticated routes an admin
+// impersonating a user may call: they show what the user sees without
+// changing anything.
+var impersonationReadOnlyRoutes = []string{
+	"GET /me/profile",
+	"GET /me/sessions",
+	"GET /me/tokens",
+	"GET /me/webauthn/credentials",
+	"GET /users/profiles",
+	"GET /users/directory",
+	"GET /users/:id",
+	"GET /users/:id/profile",
+	"GET /channels/:id",
+	"GET /channels/users/:id",
+	"GET /channels/:id/members",
+	"GET /channels/:id/bans",
+	"GET /channels/:id/join-requests",
+	"GET /channels/:id/invites",
+	"GET /todoLists/channels/:id",
+	"GET /todoLists/users/:id",
+	"GET /todoLists/:id",
+}
+
+func setupRoutes(router *gin.Engine, client *mongo.Client, mail mailer.Mailer, policy *passwordpolicy.Policy) {
+	sessionRepo := &repository.SessionRepository{Collection: client.Database("pwa").Collection("sessions")}
+	refreshTokenRepo := &repository.RefreshTokenRepository{Collection: client.Database("pwa").Collection("refreshTokens")}
 	userRepo := &repository.UserRepository{Collection: client.Database("pwa").Collection("users")}
-	userHandler := handlers.NewUserHandler(userRepo)
+	accessTokenRepo := &repository.AccessTokenRepository{Collection: client.Database("pwa").Collection("accessTokens")}
+	tokenService := service.NewTokenService(refreshTokenRepo, sessionRepo, userRepo, accessTokenRepo)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, userRepo)
+	accessTokenHandler := handlers.NewAccessTokenHandler(accessTokenService)
+	auditLogRepo := &repository.AuditLogRepository{Collection: client.Database("pwa").Collection("auditLog")}
+	impersonationService := service.NewImpersonationService(sessionRepo, userRepo, auditLogRepo)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService)
+	authMiddleware := middleware.JWTAuthMiddleware(sessionRepo, accessTokenService, impersonationService)
+	denyImpersonation := middleware.DenyImpersonation(impersonationReadOnlyRoutes...)
+	authHandler := handlers.NewAuthHandler(tokenService)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, tokenService)
+	adminBootstrapRepo := &repository.AdminBootstrapRepository{Collection: client.Database("pwa").Collection("adminBootstrap")}
+	adminHandler := handlers.NewAdminHandler(userRepo, adminBootstrapRepo, tokenService)
+	verificationService := service.NewEmailVerificationService(userRepo, mail)
+	loginThrottleRepo := &repository.LoginThrottleRepository{Collection: client.Database("pwa").Collection("loginThrottles")}
+	loginEventRepo := &repository.LoginEventRepository{Collection: client.Database("pwa").Collection("loginEvents")}
+	loginGuard := service.NewLoginGuard(loginThrottleRepo, loginEventRepo, mail)
+	passwordResetRepo := &repository.PasswordResetRepository{Collection: client.Database("pwa").Collection("passwordResets")}
 	channelRepo := &repository.ChannelRepository{Collection: client.Database("pwa").Collection("channels")}
-	channelHandler := handlers.NewChannelHandler(channelRepo)
 	todoListRepo := &repository.TodoListRepository{Collection: client.Database("pwa").Collection("todoLists")}
-	todoListHandler := handlers.NewTodoListHandler(todoListRepo)
 	notificationRepo := &repository.WebPushRepository{Collection: client.Database("pwa").Collection("webPushSubscriptions")}
+	joinRequestRepo := &repository.JoinRequestRepository{Collection: client.Database("pwa").Collection("joinRequests")}
+	exportRepo := setupDataExportRepository(client)
+	avatarRepo := setupAvatarRepository(client)
+	accountRepos := service.AccountRepositories{
+		Users:          userRepo,
+		Sessions:       sessionRepo,
+		RefreshTokens:  refreshTokenRepo,
+		AccessTokens:   accessTokenRepo,
+		PasswordResets: passwordResetRepo,
+		LoginEvents:    loginEventRepo,
+		Channels:       channelRepo,
+		TodoLists:      todoListRepo,
+		WebPush:        notificationRepo,
+		DataExports:    exportRepo,
+		Avatars:        avatarRepo,
+		JoinRequests:   joinRequestRepo,
+	}
+	channelLifecycle := setupChannelLifecycleService(client, channelRepo, todoListRepo)
+	go channelLifecycle.Run(context.Background())
+	deletionService := service.NewAccountDeletionService(client, accountRepos, channelLifecycle, mail)
+	go deletionService.Run(context.Background())
+	exportService := service.NewDataExportService(exportRepo, accountRepos)
+	go exportService.Run(context.Background())
+	exportHandler := handlers.NewExportHandler(exportService)
+	profileHandler := handlers.NewProfileHandler(service.NewProfileService(userRepo, avatarRepo))
+	registrationService := setupRegistrationService(client, channelRepo)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+	userHandler := handlers.NewUserHandler(userRepo, tokenService, verificationService, loginGuard, policy, deletionService, registrationService)
+	mfaHandler := handlers.NewMFAHandler(userRepo, service.NewMFAService(userRepo), tokenService, loginGuard)
+	webAuthnHandler := setupWebAuthnHandler(client, userRepo, tokenService)
+	oidcHandler := setupOIDCHandler(client, userRepo, tokenService, registrationService, loginGuard)
+	passwordHandler := handlers.NewPasswordHandler(service.NewPasswordResetService(userRepo, passwordResetRepo, tokenService, mail, policy))
+	webPushService := setupWebPushService(notificationRepo, channelRepo)
+	joinRequestService := service.NewJoinRequestService(joinRequestRepo, channelRepo, userRepo, webPushService)
+	channelHandler := handlers.NewChannelHandler(client, channelRepo, todoListRepo, joinRequestService, channelLifecycle)
+	todoListHandler := handlers.NewTodoListHandler(todoListRepo, channelRepo)
+	todoListHandler.WebPushService = webPushService
+	channelInviteRepo := &repository.ChannelInviteRepository{Collection: client.Database("pwa").Collection("channelInvites")}
+	channelInviteHandler := handlers.NewChannelInviteHandler(service.NewChannelInviteService(channelInviteRepo, channelRepo), channelRepo)
 	notificationHandler := handlers.NewNotificationHandler(notificationRepo)
 
 	router.POST("/login", userHandler.LoginUser)
+	router.POST("/login/mfa", mfaHandler.LoginMFA)
+	router.POST("/login/unlock", userHandler.UnlockAccount)
+	router.GET("/registration", registrationHandler.GetRegistration)
 	router.POST("/users", userHandler.CreateUser)
+	router.POST("/users/verify", userHandler.VerifyEmail)
+	router.POST("/token/refresh", authHandler.RefreshToken)
+	router.POST("/logout", authHandler.Logout)
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.POST("/password/forgot", passwordHandler.ForgotPassword)
+	router.POST("/password/reset", passwordHandler.ResetPassword)
+
+	meRoutes := router.Group("/me")
+	meRoutes.Use(authMiddleware, middleware.RequireSession(), denyImpersonation)
+	{
+		meRoutes.POST("/verify/resend", userHandler.ResendVerification)
+		meRoutes.GET("/profile", profileHandler.GetProfile)
+		meRoutes.PUT("/profile", profileHandler.UpdateProfile)
+		meRoutes.PUT("/avatar", profileHandler.UploadAvatar)
+		meRoutes.DELETE("/avatar", profileHandler.DeleteAvatar)
+		meRoutes.GET("/sessions", sessionHandler.GetSessions)
+		meRoutes.DELETE("/sessions/:id", sessionHandler.DeleteSession)
+		meRoutes.GET("/impersonations", impersonationHandler.GetImpersonations)
+		meRoutes.GET("/impersonations/:id", impersonationHandler.GetImpersonationRequests)
+		meRoutes.POST("/mfa/totp/enroll", mfaHandler.EnrollTOTP)
+		meRoutes.POST("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+		meRoutes.DELETE("/mfa/totp", mfaHandler.DisableTOTP)
+		meRoutes.POST("/tokens", accessTokenHandler.CreateAccessToken)
+		meRoutes.GET("/tokens", accessTokenHandler.GetAccessTokens)
+		meRoutes.DELETE("/tokens/:id", accessTokenHandler.RevokeAccessToken)
+		meRoutes.POST("/deletion", userHandler.ScheduleDeletion)
+		meRoutes.DELETE("/deletion", userHandler.CancelDeletion)
+		meRoutes.POST("/export", exportHandler.RequestExport)
+		meRoutes.GET("/export/:id", exportHandler.GetExport)
+		meRoutes.GET("/export/:id/download", exportHandler.DownloadExport)
+	}
+
+	if webAuthnHandler != nil {
+		router.POST("/login/webauthn/begin", webAuthnHandler.BeginLogin)
+		router.POST("/login/webauthn/finish", webAuthnHandler.FinishLogin)
+		meRoutes.POST("/webauthn/register/begin", webAuthnHandler.BeginRegistration)
+		meRoutes.POST("/webauthn/register/finish", webAuthnHandler.FinishRegistration)
+		meRoutes.GET("/webauthn/credentials", webAuthnHandler.GetPasskeys)
+		meRoutes.DELETE("/webauthn/credentials/:id", webAuthnHandler.DeletePasskey)
+	}
+
+	if oidcHandler != nil {
+		router.GET("/oidc/login", oidcHandler.Login)
+		router.POST("/oidc/callback", oidcHandler.Callback)
+	}
 
 	userRoutes := router.Group("/users")
-	userRoutes.Use(middleware.JWTAuthMiddleware())
+	userRoutes.Use(authMiddleware, middleware.RequireSession(), denyImpersonation)
 	{
-		userRoutes.GET("/", userHandler.GetUsers)
+		userRoutes.GET("/", middleware.RequireRole(models.RoleAdmin), userHandler.GetUsers)
+		userRoutes.GET("/profiles", profileHandler.GetPublicProfiles)
+		userRoutes.GET("/directory", profileHandler.GetDirectory)
 		userRoutes.GET("/:id", userHandler.GetUser)
+		userRoutes.GET("/:id/profile", profileHandler.GetPublicProfile)
 		userRoutes.PUT("/:id", userHandler.UpdateUser)
-		userRoutes.DELETE("/:id", userHandler.DeleteUser)
+		userRoutes.DELETE("/:id", middleware.RequireRole(models.RoleAdmin), userHandler.DeleteUser)
+		userRoutes.PUT("/:id/role", middleware.RequireRole(models.RoleAdmin), adminHandler.SetUserRole)
+		userRoutes.POST("/:id/impersonate", middleware.RequireRole(models.RoleAdmin), impersonationHandler.Impersonate)
+	}
+
+	router.GET("/users/:id/avatar", profileHandler.GetAvatar)
+	router.POST("/admin/bootstrap", authMiddleware, middleware.RequireSession(), middleware.DenyImpersonation(), adminHandler.BootstrapAdmin)
+
+	adminRoutes := router.Group("/admin")
+	adminRoutes.Use(authMiddleware, middleware.RequireSession(), middleware.RequireRole(models.RoleAdmin), middleware.DenyImpersonation())
+	{
+		adminRoutes.POST("/invites", registrationHandler.CreateInvite)
+		adminRoutes.GET("/invites", registrationHandler.GetInvites)
+		adminRoutes.DELETE("/invites/:id", registrationHandler.RevokeInvite)
 	}
 
 	channelRoutes := router.Group("/channels")
-	channelRoutes.Use(middleware.JWTAuthMiddleware())
+	channelRoutes.Use(authMiddleware, denyImpersonation)
 	{
-		channelRoutes.POST("/", channelHandler.CreateChannel)
-		channelRoutes.GET("/:id", channelHandler.GetChannel)
-		channelRoutes.GET("/users/:id", channelHandler.GetChannelsByUserID)
-		channelRoutes.PUT("/:id", channelHandler.UpdateChannel)
-		channelRoutes.DELETE("/:id", channelHandler.DeleteChannel)
-		channelRoutes.POST("/:id/join", channelHandler.JoinChannel)
-		channelRoutes.POST("/:id/leave", channelHandler.LeaveChannel)
+		channelRoutes.POST("/", middleware.RequireScope(models.ScopeChannelsWrite), middleware.RequireVerifiedEmail(userRepo, middleware.FeatureCreateChannel), channelHandler.CreateChannel)
+		channelRoutes.GET("/:id", middleware.RequireScope(models.ScopeChannelsRead), channelHandler.GetChannel)
+		channelRoutes.GET("/users/:id", middleware.RequireScope(models.ScopeChannelsRead), channelHandler.GetChannelsByUserID)
+		channelRoutes.PUT("/:id", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.UpdateChannel)
+		channelRoutes.DELETE("/:id", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.DeleteChannel)
+		channelRoutes.POST("/:id/join", middleware.RequireScope(models.ScopeChannelsWrite), middleware.RequireVerifiedEmail(userRepo, middleware.FeatureJoinChannel), channelHandler.JoinChannel)
+		channelRoutes.POST("/:id/leave", middleware.RequireScope(models.ScopeChannelsWrite), channelHandler.LeaveChannel)
+		channelRoutes.POST("/:id/transfer", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.TransferOwnership)
+		channelRoutes.GET("/:id/members", middleware.RequireScope(models.ScopeChannelsRead), channelHandler.GetMembers)
+		channelRoutes.PUT("/:id/members/:userId/role", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.SetMemberRole)
+		channelRoutes.DELETE("/:id/members/:userId", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.RemoveMember)
+		channelRoutes.POST("/:id/bans", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.BanUser)
+		channelRoutes.GET("/:id/bans", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.GetBans)
+		channelRoutes.DELETE("/:id/bans/:userId", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.UnbanUser)
+		channelRoutes.GET("/:id/join-requests", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.GetJoinRequests)
+		channelRoutes.POST("/:id/join-requests/:requestId/approve", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.ApproveJoinRequest)
+		channelRoutes.POST("/:id/join-requests/:requestId/deny", middleware.RequireScope(models.ScopeChannelsAdmin), channelHandler.DenyJoinRequest)
+		channelRoutes.POST("/:id/invites", middleware.RequireScope(models.ScopeChannelsAdmin), channelInviteHandler.CreateInvite)
+		channelRoutes.GET("/:id/invites", middleware.RequireScope(models.ScopeChannelsAdmin), channelInviteHandler.GetInvites)
+		channelRoutes.DELETE("/:id/invites/:inviteId", middleware.RequireScope(models.ScopeChannelsAdmin), channelInviteHandler.RevokeInvite)
 	}
 
+	router.POST("/invites/:token/accept", authMiddleware, denyImpersonation, middleware.RequireScope(models.ScopeChannelsWrite), middleware.RequireVerifiedEmail(userRepo, middleware.FeatureJoinChannel), channelInviteHandler.AcceptInvite)
+
 	todoListRoutes := router.Group("/todoLists")
-	todoListRoutes.Use(middleware.JWTAuthMiddleware())
+	todoListRoutes.Use(authMiddleware, denyImpersonation)
 	{
-		todoListRoutes.POST("/:id/tasks", todoListHandler.AddTask)
-		todoListRoutes.PUT("/:todoListId/tasks/:taskId", todoListHandler.UpdateTask)
-		todoListRoutes.DELETE("/:todoListId/tasks/:taskId", todoListHandler.DeleteTask)
-		todoListRoutes.GET("/channels/:id", todoListHandler.GetTodoListByChannelID)
-		todoListRoutes.GET("/:id", todoListHandler.GetTodoList)
-		todoListRoutes.PUT("/:id", todoListHandler.UpdateTodoList)
-		todoListRoutes.DELETE("/:id", todoListHandler.DeleteTodoList)
-		todoListRoutes.POST("/", todoListHandler.CreateTodoList)
-	}
-
-	router.POST("/subscribe", notificationHandler.Subscribe)
-	router.POST("/unsubscribe/:id", notificationHandler.Unsubscribe)
+		todoListRoutes.POST("/:id/tasks", middleware.RequireScope(models.ScopeTodoListsWrite), todoListHandler.AddTask)
+		todoListRoutes.PUT("/:id/tasks/:taskId", middleware.RequireScope(models.ScopeTodoListsWrite), todoListHandler.UpdateTask)
+		todoListRoutes.DELETE("/:id/tasks/:taskId", middleware.RequireScope(models.ScopeTodoListsWrite), todoListHandler.DeleteTask)
+		todoListRoutes.GET("/channels/:id", middleware.RequireScope(models.ScopeTodoListsRead), todoListHandler.GetTodoListByChannelID)
+		todoListRoutes.GET("/users/:id", middleware.RequireScope(models.ScopeTodoListsRead), todoListHandler.GetTodoListsByUserID)
+		todoListRoutes.GET("/:id", middleware.RequireScope(models.ScopeTodoListsRead), todoListHandler.GetTodoList)
+		todoListRoutes.PUT("/:id", middleware.RequireScope(models.ScopeTodoListsWrite), todoListHandler.UpdateTodoList)
+		todoListRoutes.DELETE("/:id", middleware.RequireScope(models.ScopeTodoListsWrite), todoListHandler.DeleteTodoList)
+		todoListRoutes.POST("/", middleware.RequireScope(models.ScopeTodoListsWrite), middleware.RequireVerifiedEmail(userRepo, middleware.FeatureCreateTodoList), todoListHandler.CreateTodoList)
+	}
+
+	router.POST("/subscribe", authMiddleware, middleware.RequireSession(), denyImpersonation, middleware.RequireVerifiedEmail(userRepo, middleware.FeaturePushSubscribe), notificationHandler.Subscribe)
+	router.POST("/unsubscribe/:id", authMiddleware, middleware.RequireSession(), denyImpersonation, notificationHandler.Unsubscribe)
 
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
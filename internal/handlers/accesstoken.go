@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+)
+
+func NewAccessTokenHandler(tokens *service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{Tokens: tokens}
+}
+
+type AccessTokenHandler struct {
+	Tokens *service.AccessTokenService
+}
+
+// CreateAccessToken godoc
+// @Summary Create a personal access token
+// @Description Creates a scoped token for scripts and integrations. The token is only shown in this response.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param request body models.CreateAccessTokenRequest true "Name, scopes and optional expiry"
+// @Success 201 {object} map[string]interface{} "token and its metadata"
+// @Failure 400 {object} map[string]interface{} "Invalid scopes or expiry"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/tokens [post]
+func (h *AccessTokenHandler) CreateAccessToken(c *gin.Context) {
+	var request models.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid token data")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	token, plaintext, err := h.Tokens.Create(c, userID, request)
+	if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidExpiry) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": plaintext, "accessToken": token})
+}
+
+// GetAccessTokens godoc
+// @Summary List personal access tokens
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} models.PersonalAccessToken
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/tokens [get]
+func (h *AccessTokenHandler) GetAccessTokens(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	tokens, err := h.Tokens.List(c, userID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to retrieve tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeAccessToken godoc
+// @Summary Revoke a personal access token
+// @Tags tokens
+// @Param id path string true "Token ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Token not found"
+// @Router /me/tokens/{id} [delete]
+func (h *AccessTokenHandler) RevokeAccessToken(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	err = h.Tokens.Revoke(c, userID, c.Param("id"))
+	if errors.Is(err, service.ErrAccessTokenNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"net/http"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+)
+
+func NewAdminHandler(repo *repository.UserRepository, bootstrap *repository.AdminBootstrapRepository, tokens *service.TokenService) *AdminHandler {
+	return &AdminHandler{Repo: repo, Bootstrap: bootstrap, Tokens: tokens}
+}
+
+type AdminHandler struct {
+	Repo      *repository.UserRepository
+	Bootstrap *repository.AdminBootstrapRepository
+	Tokens    *service.TokenService
+}
+
+// BootstrapAdmin godoc
+// @Summary Promote the first admin
+// @Description Makes the caller an admin when no admin exists yet and the token matches ADMIN_BOOTSTRAP_TOKEN. Refresh the access token afterwards to pick up the new role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.BootstrapAdminRequest true "Bootstrap token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Invalid token"
+// @Failure 409 {object} map[string]interface{} "An admin already exists"
+// @Router /admin/bootstrap [post]
+func (h *AdminHandler) BootstrapAdmin(c *gin.Context) {
+	var request models.BootstrapAdminRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	expected := os.Getenv("ADMIN_BOOTSTRAP_TOKEN")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(request.Token), []byte(expected)) != 1 {
+		respondWithError(c, http.StatusForbidden, "Invalid bootstrap token")
+		return
+	}
+
+	admins, err := h.Repo.CountAdmins(c)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to check admins")
+		return
+	}
+	if admins > 0 {
+		respondWithError(c, http.StatusConflict, "An admin already exists")
+		return
+	}
+
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	// Counting admins alone would let two concurrent requests both see
+	// none; the marker document lets only one of them through.
+	claimed, err := h.Bootstrap.Claim(c, user.ID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to check admins")
+		return
+	}
+	if !claimed {
+		respondWithError(c, http.StatusConflict, "An admin already exists")
+		return
+	}
+	if _, err := h.Repo.SetRole(c, user.ID, models.RoleAdmin); err != nil {
+		if err := h.Bootstrap.Release(c, user.ID); err != nil {
+			log.Printf("Failed to release admin bootstrap for user %s: %v", user.ID.Hex(), err)
+		}
+		respondWithError(c, http.StatusInternalServerError, "Failed to promote user")
+		return
+	}
+
+	log.Printf("User %s bootstrapped as the first admin", user.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "You are now an admin. Refresh your token to use the new role."})
+}
+
+// SetUserRole godoc
+// @Summary Change a user's global role
+// @Description Promotes or demotes a user. Demoted users are signed out so their tokens stop carrying the old role. The last admin cannot be demoted.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.UpdateRoleRequest true "New role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 409 {object} map[string]interface{} "Cannot demote the last admin"
+// @Router /users/{id}/role [put]
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	var request models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	user, err := h.Repo.FindUserByID(c, userID.Hex())
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	demoting := user.GlobalRole() == models.RoleAdmin && request.Role != models.RoleAdmin
+	if demoting {
+		admins, err := h.Repo.CountAdmins(c)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, "Failed to check admins")
+			return
+		}
+		if admins <= 1 {
+			respondWithError(c, http.StatusConflict, "Cannot demote the last admin")
+			return
+		}
+	}
+
+	if _, err := h.Repo.SetRole(c, userID, request.Role); err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to update role")
+		return
+	}
+
+	if demoting {
+		if err := h.Tokens.RevokeAll(c, userID); err != nil {
+			log.Printf("Failed to revoke sessions of demoted user %s: %v", userID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "role": request.Role})
+}
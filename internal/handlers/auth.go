@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+	"pwa/pkg/jwt"
+	"strconv"
+)
+
+func NewAuthHandler(tokens *service.TokenService) *AuthHandler {
+	return &AuthHandler{Tokens: tokens}
+}
+
+type AuthHandler struct {
+	Tokens *service.TokenService
+}
+
+// sessionInfo describes the calling client. The device name falls back to
+// the X-Device-Name header when the request body does not carry one.
+func sessionInfo(c *gin.Context, deviceName string) models.SessionInfo {
+	if deviceName == "" {
+		deviceName = c.GetHeader("X-Device-Name")
+	}
+	return models.SessionInfo{
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+	}
+}
+
+func respondWithTokens(c *gin.Context, code int, message string, tokens service.TokenPair) {
+	c.JSON(code, gin.H{
+		"message":      message,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+	})
+}
+
+func loginAttempt(c *gin.Context, identifier, method string, user *models.User) service.LoginAttempt {
+	return service.LoginAttempt{
+		Identifier: identifier,
+		Method:     method,
+		User:       user,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+}
+
+// checkLoginAllowed answers 429 with a Retry-After header and returns false
+// while the guard is holding off attempts for the account or client.
+func checkLoginAllowed(c *gin.Context, guard *service.LoginGuard, attempt service.LoginAttempt) bool {
+	err := guard.Check(c, attempt)
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		seconds := int(throttled.RetryAfter.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error(), "locked": throttled.Locked, "retryAfter": seconds})
+		return false
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Login failed")
+		return false
+	}
+	return true
+}
+
+// currentUser loads the authenticated caller, responding with an error and
+// returning false when that fails.
+func currentUser(c *gin.Context, repo *repository.UserRepository) (models.User, bool) {
+	user, err := repo.FindUserByID(c, c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return user, false
+	}
+	return user, true
+}
+
+// RefreshToken godoc
+// @Summary Rotate a refresh token
+// @Description Exchanges a refresh token for a new access and refresh token pair. Replaying an already rotated refresh token revokes the whole token family.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} service.TokenPair
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 401 {object} map[string]interface{} "Invalid, expired or reused refresh token"
+// @Router /token/refresh [post]
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var request models.RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid refresh request")
+		return
+	}
+
+	pair, err := h.Tokens.Refresh(c, request.RefreshToken, sessionInfo(c, ""))
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		respondWithError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Ends the session the given refresh token belongs to.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 401 {object} map[string]interface{} "Unknown refresh token"
+// @Router /logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var request models.RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid logout request")
+		return
+	}
+
+	err := h.Tokens.Revoke(c, request.RefreshToken)
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		respondWithError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// JWKS godoc
+// @Summary Public signing keys
+// @Description Serves the public keys access tokens are signed with, including retired keys that may still verify unexpired tokens.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.JSONWebKeySet
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	keyring, err := jwt.DefaultKeyring()
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Signing keys not configured")
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keyring.JWKS())
+}
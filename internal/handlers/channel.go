@@ -1,30 +1,73 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
 	"net/http"
 	"pwa/internal/models"
 	"pwa/internal/repository"
+	"pwa/internal/service"
+	"pwa/pkg/mongodb"
+	"strings"
 	"time"
 )
 
-func NewChannelHandler(repo *repository.ChannelRepository) *ChannelHandler {
-	return &ChannelHandler{Repo: repo}
+func NewChannelHandler(client *mongo.Client, repo *repository.ChannelRepository, todoLists *repository.TodoListRepository, joinRequests *service.JoinRequestService, lifecycle *service.ChannelLifecycleService) *ChannelHandler {
+	return &ChannelHandler{Client: client, Repo: repo, TodoLists: todoLists, JoinRequests: joinRequests, Lifecycle: lifecycle}
 }
 
 type ChannelHandler struct {
-	Repo *repository.ChannelRepository
+	Client       *mongo.Client
+	Repo         *repository.ChannelRepository
+	TodoLists    *repository.TodoListRepository
+	JoinRequests *service.JoinRequestService
+	Lifecycle    *service.ChannelLifecycleService
+}
+
+// authorizeChannel loads the channel and checks that the caller's role in
+// it grants permission, responding with an error and returning false when
+// it does not.
+func authorizeChannel(c *gin.Context, repo *repository.ChannelRepository, channelID string, permission models.ChannelPermission) (models.Channel, bool) {
+	channel, err := repo.FindChannelByID(c, channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return channel, false
+	}
+
+	role := channel.MemberRole(c.GetString("userID"))
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this channel"})
+		return channel, false
+	}
+	if !models.ChannelRoleAllows(role, permission) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role in this channel does not allow this action"})
+		return channel, false
+	}
+	return channel, true
 }
 
 func (h *ChannelHandler) CreateChannel(c *gin.Context) {
-	var newChannel models.Channel
-	if err := c.ShouldBindJSON(&newChannel); err != nil {
+	var request models.CreateChannelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	newChannel.CreatedAt = time.Now()
-	newChannel.UpdatedAt = time.Now()
+	userID := c.GetString("userID")
+	now := time.Now()
+	newChannel := models.Channel{
+		Name:        request.Name,
+		Password:    request.Password,
+		Members:     []string{userID},
+		Memberships: []models.ChannelMember{{UserID: userID, Role: models.ChannelRoleOwner, JoinedAt: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
 
 	result, err := h.Repo.CreateChannel(c, newChannel)
 	if err != nil {
@@ -36,10 +79,8 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 }
 
 func (h *ChannelHandler) GetChannel(c *gin.Context) {
-	id := c.Param("id")
-	channel, err := h.Repo.FindChannelByID(c, id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionViewChannel)
+	if !ok {
 		return
 	}
 
@@ -48,6 +89,11 @@ func (h *ChannelHandler) GetChannel(c *gin.Context) {
 
 func (h *ChannelHandler) GetChannelsByUserID(c *gin.Context) {
 	userID := c.Param("id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
 	channels, err := h.Repo.FindChannelsByUserID(c, userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Channels not found"})
@@ -59,14 +105,23 @@ func (h *ChannelHandler) GetChannelsByUserID(c *gin.Context) {
 
 func (h *ChannelHandler) UpdateChannel(c *gin.Context) {
 	id := c.Param("id")
-	var channel models.Channel
-	if err := c.ShouldBindJSON(&channel); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := authorizeChannel(c, h.Repo, id, models.PermissionUpdateChannel); !ok {
+		return
+	}
+
+	var request models.UpdateChannelRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data: " + err.Error()})
+		return
+	}
+	if request.Name != nil && strings.TrimSpace(*request.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel name cannot be empty"})
 		return
 	}
 
-	channel.UpdatedAt = time.Now()
-	result, err := h.Repo.UpdateChannel(c, id, channel)
+	result, err := h.Repo.UpdateChannel(c, id, request)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -77,7 +132,21 @@ func (h *ChannelHandler) UpdateChannel(c *gin.Context) {
 
 func (h *ChannelHandler) DeleteChannel(c *gin.Context) {
 	id := c.Param("id")
-	result, err := h.Repo.DeleteChannel(c, id)
+	if _, ok := authorizeChannel(c, h.Repo, id, models.PermissionDeleteChannel); !ok {
+		return
+	}
+
+	// The lists go first so that, where transactions are unsupported, a
+	// failure leaves a channel to retry on rather than orphaned lists.
+	var result *mongo.DeleteResult
+	err := mongodb.WithTransaction(c, h.Client, func(ctx context.Context) error {
+		if err := h.TodoLists.DeleteTodoListsByChannelID(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		result, err = h.Repo.DeleteChannel(ctx, id)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -86,11 +155,25 @@ func (h *ChannelHandler) DeleteChannel(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// JoinChannel godoc
+// @Summary Join a channel
+// @Description With the channel password the user joins as a member right away. Without one, a join request is filed and the channel's owner and admins are notified.
+// @Tags channels
+// @Accept json
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param request body models.JoinChannelRequest false "Password or a message for the admins"
+// @Success 200 {object} map[string]interface{} "Joined"
+// @Success 202 {object} map[string]interface{} "Join request filed"
+// @Failure 401 {object} map[string]interface{} "Invalid channel password"
+// @Failure 403 {object} map[string]interface{} "Banned from the channel"
+// @Failure 404 {object} map[string]interface{} "Channel not found"
+// @Failure 409 {object} map[string]interface{} "Already a member or a request is pending"
+// @Failure 410 {object} map[string]interface{} "Channel is archived"
+// @Router /channels/{id}/join [post]
 func (h *ChannelHandler) JoinChannel(c *gin.Context) {
-	var request struct {
-		Password string `json:"password"`
-	}
-	if err := c.BindJSON(&request); err != nil {
+	var request models.JoinChannelRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad request"})
 		return
 	}
@@ -98,6 +181,21 @@ func (h *ChannelHandler) JoinChannel(c *gin.Context) {
 	userID := c.GetString("userID")
 	channelID := c.Param("id")
 
+	channel, err := h.Repo.FindChannelByID(c, channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+	if err := service.CheckJoin(channel, userID); err != nil {
+		respondWithJoinError(c, err)
+		return
+	}
+
+	if request.Password == "" {
+		h.requestToJoin(c, channel, userID, request.Message)
+		return
+	}
+
 	ok, err := h.Repo.CheckChannelPassword(c, channelID, request.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify channel password", "details": err.Error()})
@@ -108,20 +206,407 @@ func (h *ChannelHandler) JoinChannel(c *gin.Context) {
 		return
 	}
 
-	if err := h.Repo.JoinChannel(c, channelID, userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join channel", "details": err.Error()})
+	err = h.Repo.JoinChannel(c, channelID, userID, models.ChannelRoleMember)
+	if errors.Is(err, repository.ErrChannelNotJoined) {
+		// The channel changed after it was checked above.
+		channel, err = h.Repo.FindChannelByID(c, channelID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return
+		}
+		if err = service.CheckJoin(channel, userID); err == nil {
+			err = repository.ErrChannelNotJoined
+		}
+	}
+	if err != nil {
+		respondWithJoinError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully joined channel"})
 }
 
+// respondWithJoinError maps the reasons service.CheckJoin gives to the
+// status codes documented on JoinChannel.
+func respondWithJoinError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrAlreadyChannelMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelBanned):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChannelArchived):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join channel", "details": err.Error()})
+	}
+}
+
+func (h *ChannelHandler) requestToJoin(c *gin.Context, channel models.Channel, userID, message string) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		return
+	}
+
+	joinRequest, err := h.JoinRequests.Request(c, channel, uid, message)
+	switch {
+	case errors.Is(err, service.ErrAlreadyChannelMember), errors.Is(err, service.ErrJoinRequestPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrChannelBanned):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Join request sent", "request": joinRequest})
+}
+
+// LeaveChannel godoc
+// @Summary Leave a channel
+// @Description Removes the caller from the channel. An owner who leaves hands the channel to the longest-standing admin, or failing that the longest-standing member. When the last member leaves, the empty channel policy applies.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Not a member of the channel"
+// @Router /channels/{id}/leave [post]
 func (h *ChannelHandler) LeaveChannel(c *gin.Context) {
-	userID := c.GetString("userID")
-	channelID := c.Param("id")
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionViewChannel)
+	if !ok {
+		return
+	}
 
-	if err := h.Repo.LeaveChannel(c, channelID, userID); err != nil {
+	if err := h.Lifecycle.Leave(c, channel, c.GetString("userID")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave channel", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully left channel"})
 }
+
+// TransferOwnership godoc
+// @Summary Transfer channel ownership
+// @Description Makes another member the owner of the channel. The previous owner stays on as an admin.
+// @Tags channels
+// @Accept json
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param request body models.TransferOwnershipRequest true "New owner"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "New owner is not another member"
+// @Failure 403 {object} map[string]interface{} "Not the owner"
+// @Router /channels/{id}/transfer [post]
+func (h *ChannelHandler) TransferOwnership(c *gin.Context) {
+	var request models.TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionTransferChannel)
+	if !ok {
+		return
+	}
+
+	err := h.Lifecycle.Transfer(c, channel, c.GetString("userID"), request.UserID)
+	if errors.Is(err, service.ErrInvalidNewOwner) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ownership transferred", "owner": request.UserID})
+}
+
+// GetMembers godoc
+// @Summary List channel members
+// @Description Lists the members of a channel with their roles: owner, admin, member or viewer.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Success 200 {array} models.ChannelMember
+// @Failure 403 {object} map[string]interface{} "Not a member of the channel"
+// @Failure 404 {object} map[string]interface{} "Channel not found"
+// @Router /channels/{id}/members [get]
+func (h *ChannelHandler) GetMembers(c *gin.Context) {
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionViewChannel)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, channel.MemberList())
+}
+
+// SetMemberRole godoc
+// @Summary Change a member's role
+// @Description Owners and admins can change the role of members ranked below them, to a role ranked below their own. The owner role cannot be assigned here.
+// @Tags channels
+// @Accept json
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param userId path string true "User ID"
+// @Param request body models.UpdateMemberRoleRequest true "New role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Not allowed to change this member's role"
+// @Failure 404 {object} map[string]interface{} "Channel or member not found"
+// @Router /channels/{id}/members/{userId}/role [put]
+func (h *ChannelHandler) SetMemberRole(c *gin.Context) {
+	var request models.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	channelID := c.Param("id")
+	channel, ok := authorizeChannel(c, h.Repo, channelID, models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	targetID := c.Param("userId")
+	actorRole := channel.MemberRole(c.GetString("userID"))
+	targetRole := channel.MemberRole(targetID)
+	if targetRole == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if !models.ChannelRoleOutranks(actorRole, targetRole) || !models.ChannelRoleOutranks(actorRole, request.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage members and roles ranked below your own"})
+		return
+	}
+
+	found, err := h.Repo.SetMemberRole(c, channelID, targetID, request.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role", "details": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "role": request.Role})
+}
+
+// RemoveMember godoc
+// @Summary Remove a member
+// @Description Owners and admins can remove members ranked below them from the channel. The member loses access to the channel's todo lists right away but can join again; ban them to keep them out.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Not allowed to remove this member"
+// @Failure 404 {object} map[string]interface{} "Channel or member not found"
+// @Router /channels/{id}/members/{userId} [delete]
+func (h *ChannelHandler) RemoveMember(c *gin.Context) {
+	channelID := c.Param("id")
+	channel, ok := authorizeChannel(c, h.Repo, channelID, models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	targetID := c.Param("userId")
+	targetRole := channel.MemberRole(targetID)
+	if targetRole == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if !models.ChannelRoleOutranks(channel.MemberRole(c.GetString("userID")), targetRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage members and roles ranked below your own"})
+		return
+	}
+
+	if err := h.Repo.LeaveChannel(c, channelID, targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// BanUser godoc
+// @Summary Ban a user from a channel
+// @Description Removes the user from the channel, if they are a member, and keeps them out until the ban expires or is lifted. Owners and admins can only ban users ranked below them.
+// @Tags channels
+// @Accept json
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param request body models.BanUserRequest true "User, optional reason and expiry"
+// @Success 201 {object} models.ChannelBan
+// @Failure 400 {object} map[string]interface{} "Invalid user or expiry"
+// @Failure 403 {object} map[string]interface{} "Not allowed to ban this user"
+// @Router /channels/{id}/bans [post]
+func (h *ChannelHandler) BanUser(c *gin.Context) {
+	var request models.BanUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ban data"})
+		return
+	}
+	if !primitive.IsValidObjectID(request.UserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	channelID := c.Param("id")
+	channel, ok := authorizeChannel(c, h.Repo, channelID, models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	actorID := c.GetString("userID")
+	if request.UserID == actorID || !models.ChannelRoleOutranks(channel.MemberRole(actorID), channel.MemberRole(request.UserID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage members and roles ranked below your own"})
+		return
+	}
+
+	ban := models.ChannelBan{
+		UserID:    request.UserID,
+		Reason:    request.Reason,
+		BannedBy:  actorID,
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := h.Repo.BanUser(c, channelID, ban); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ban user", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, ban)
+}
+
+// GetBans godoc
+// @Summary List channel bans
+// @Description Lists the bans that have not expired yet.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Success 200 {array} models.ChannelBan
+// @Failure 403 {object} map[string]interface{} "Not allowed to manage this channel's members"
+// @Router /channels/{id}/bans [get]
+func (h *ChannelHandler) GetBans(c *gin.Context) {
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, channel.ActiveBans())
+}
+
+// UnbanUser godoc
+// @Summary Lift a channel ban
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Ban not found"
+// @Router /channels/{id}/bans/{userId} [delete]
+func (h *ChannelHandler) UnbanUser(c *gin.Context) {
+	channelID := c.Param("id")
+	if _, ok := authorizeChannel(c, h.Repo, channelID, models.PermissionManageMembers); !ok {
+		return
+	}
+
+	found, err := h.Repo.UnbanUser(c, channelID, c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift ban", "details": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ban not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ban lifted"})
+}
+
+// GetJoinRequests godoc
+// @Summary List join requests
+// @Description Lists the channel's join requests, newest first. Decided requests are kept for audit.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param status query string false "pending, approved, denied or cancelled"
+// @Success 200 {array} models.JoinRequest
+// @Failure 400 {object} map[string]interface{} "Invalid status"
+// @Failure 403 {object} map[string]interface{} "Not allowed to manage this channel's members"
+// @Router /channels/{id}/join-requests [get]
+func (h *ChannelHandler) GetJoinRequests(c *gin.Context) {
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	requests, err := h.JoinRequests.List(c, channel.ID, c.Query("status"))
+	if errors.Is(err, service.ErrInvalidJoinStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve join requests", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveJoinRequest godoc
+// @Summary Approve a join request
+// @Description Adds the requester to the channel as a member and notifies them.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param requestId path string true "Join request ID"
+// @Success 200 {object} models.JoinRequest
+// @Failure 404 {object} map[string]interface{} "Pending join request not found"
+// @Failure 409 {object} map[string]interface{} "Requester is banned"
+// @Failure 410 {object} map[string]interface{} "Channel is archived"
+// @Router /channels/{id}/join-requests/{requestId}/approve [post]
+func (h *ChannelHandler) ApproveJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, true)
+}
+
+// DenyJoinRequest godoc
+// @Summary Deny a join request
+// @Description Turns the request down and notifies the requester.
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param requestId path string true "Join request ID"
+// @Success 200 {object} models.JoinRequest
+// @Failure 404 {object} map[string]interface{} "Pending join request not found"
+// @Router /channels/{id}/join-requests/{requestId}/deny [post]
+func (h *ChannelHandler) DenyJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, false)
+}
+
+func (h *ChannelHandler) decideJoinRequest(c *gin.Context, approve bool) {
+	channel, ok := authorizeChannel(c, h.Repo, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+	deciderID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		return
+	}
+
+	request, err := h.JoinRequests.Decide(c, channel, c.Param("requestId"), deciderID, approve)
+	switch {
+	case errors.Is(err, service.ErrJoinRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrRequesterBanned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrChannelArchived):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decide join request", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+)
+
+func NewChannelInviteHandler(invites *service.ChannelInviteService, channels *repository.ChannelRepository) *ChannelInviteHandler {
+	return &ChannelInviteHandler{Invites: invites, Channels: channels}
+}
+
+type ChannelInviteHandler struct {
+	Invites  *service.ChannelInviteService
+	Channels *repository.ChannelRepository
+}
+
+// CreateInvite godoc
+// @Summary Create a channel invite link
+// @Description Issues a link that adds whoever accepts it to the channel. The link grants a role ranked below the creator's, expires, and can be limited in uses. The token is only shown in this response.
+// @Tags channels
+// @Accept json
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param request body models.CreateChannelInviteRequest true "Invite settings"
+// @Success 201 {object} map[string]interface{} "token, url and the invite"
+// @Failure 400 {object} map[string]interface{} "Invalid role, uses or expiry"
+// @Failure 403 {object} map[string]interface{} "Not allowed to invite to this channel or grant this role"
+// @Router /channels/{id}/invites [post]
+func (h *ChannelInviteHandler) CreateInvite(c *gin.Context) {
+	var request models.CreateChannelInviteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid invite data")
+		return
+	}
+
+	channel, ok := authorizeChannel(c, h.Channels, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	creatorID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	invite, token, err := h.Invites.Create(c, channel, creatorID, request)
+	switch {
+	case errors.Is(err, service.ErrInviteRoleNotAllowed):
+		respondWithError(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidInviteSettings):
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, "Failed to create invite link")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "url": h.Invites.Link(token), "invite": invite})
+}
+
+// GetInvites godoc
+// @Summary List channel invite links
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Success 200 {array} models.ChannelInvite
+// @Failure 403 {object} map[string]interface{} "Not allowed to manage this channel's members"
+// @Router /channels/{id}/invites [get]
+func (h *ChannelInviteHandler) GetInvites(c *gin.Context) {
+	channel, ok := authorizeChannel(c, h.Channels, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	invites, err := h.Invites.List(c, channel.ID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to retrieve invite links")
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInvite godoc
+// @Summary Revoke a channel invite link
+// @Tags channels
+// @Produce json
+// @Param id path string true "Channel ID"
+// @Param inviteId path string true "Invite ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Invite link not found"
+// @Router /channels/{id}/invites/{inviteId} [delete]
+func (h *ChannelInviteHandler) RevokeInvite(c *gin.Context) {
+	channel, ok := authorizeChannel(c, h.Channels, c.Param("id"), models.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	err := h.Invites.Revoke(c, channel.ID, c.Param("inviteId"))
+	if errors.Is(err, service.ErrChannelInviteNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to revoke invite link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite link revoked"})
+}
+
+// AcceptInvite godoc
+// @Summary Accept a channel invite link
+// @Description Joins the channel the link points to with the role it grants.
+// @Tags channels
+// @Produce json
+// @Param token path string true "Invite token"
+// @Success 200 {object} map[string]interface{} "channelId and role"
+// @Failure 403 {object} map[string]interface{} "Banned from the channel"
+// @Failure 404 {object} map[string]interface{} "Invalid, expired or used up link"
+// @Failure 409 {object} map[string]interface{} "Already a member"
+// @Failure 410 {object} map[string]interface{} "Channel is archived"
+// @Router /invites/{token}/accept [post]
+func (h *ChannelInviteHandler) AcceptInvite(c *gin.Context) {
+	channel, role, err := h.Invites.Accept(c, c.Param("token"), c.GetString("userID"))
+	switch {
+	case errors.Is(err, service.ErrInvalidChannelInvite):
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, service.ErrAlreadyChannelMember):
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, service.ErrChannelBanned):
+		respondWithError(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, service.ErrChannelArchived):
+		respondWithError(c, http.StatusGone, err.Error())
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, "Failed to join channel")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully joined channel", "channelId": channel.ID, "role": role})
+}
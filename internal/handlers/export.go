@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"log"
+	"net/http"
+	"pwa/internal/service"
+	"strconv"
+)
+
+func NewExportHandler(exports *service.DataExportService) *ExportHandler {
+	return &ExportHandler{Exports: exports}
+}
+
+type ExportHandler struct {
+	Exports *service.DataExportService
+}
+
+// RequestExport godoc
+// @Summary Export your data
+// @Description Starts building a zip archive with the caller's profile, channels, todo lists, tasks and push subscriptions. Poll the returned export until its status is "ready".
+// @Tags export
+// @Produce json
+// @Success 202 {object} models.DataExport
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/export [post]
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	export, err := h.Exports.Request(c, userID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to start export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExport godoc
+// @Summary Get export status
+// @Tags export
+// @Produce json
+// @Param id path string true "Export ID"
+// @Success 200 {object} models.DataExport
+// @Failure 404 {object} map[string]interface{} "Export not found"
+// @Router /me/export/{id} [get]
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	export, err := h.Exports.Get(c, userID, c.Param("id"))
+	if errors.Is(err, service.ErrExportNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to retrieve export")
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadExport godoc
+// @Summary Download an export
+// @Tags export
+// @Produce application/zip
+// @Param id path string true "Export ID"
+// @Success 200 {file} file "Zip archive"
+// @Failure 404 {object} map[string]interface{} "Export not found or expired"
+// @Failure 409 {object} map[string]interface{} "Export not ready yet"
+// @Router /me/export/{id}/download [get]
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	export, archive, err := h.Exports.Open(c, userID, c.Param("id"))
+	switch {
+	case errors.Is(err, service.ErrExportNotFound):
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, service.ErrExportNotReady):
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, "Failed to open export")
+		return
+	}
+	defer archive.Close()
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="pwa-export-`+export.CreatedAt.Format("2006-01-02")+`.zip"`)
+	c.Header("Content-Length", strconv.FormatInt(export.Size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, archive); err != nil {
+		log.Printf("Failed to send export %s: %v", export.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+)
+
+func NewImpersonationHandler(impersonations *service.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{Impersonations: impersonations}
+}
+
+type ImpersonationHandler struct {
+	Impersonations *service.ImpersonationService
+}
+
+// Impersonate godoc
+// @Summary Impersonate a user
+// @Description Issues a short-lived access token that acts as the user for support purposes. The token carries the admin in its act claim, cannot be refreshed, only reaches read-only routes, and every request made with it is recorded in an audit log the user can read. Admins cannot be impersonated.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.ImpersonateRequest true "Reason for the impersonation"
+// @Success 201 {object} service.TokenPair
+// @Failure 400 {object} map[string]interface{} "A reason is required"
+// @Failure 403 {object} map[string]interface{} "The user cannot be impersonated"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Router /users/{id}/impersonate [post]
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	var request models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "A reason is required")
+		return
+	}
+
+	actorID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	pair, err := h.Impersonations.Start(c, actorID, c.Param("id"), request.Reason, sessionInfo(c, ""))
+	if errors.Is(err, service.ErrImpersonationTargetNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, service.ErrCannotImpersonate) {
+		respondWithError(c, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, pair)
+}
+
+// GetImpersonations godoc
+// @Summary List impersonations of my account
+// @Description Lists every session in which an admin acted as the authenticated user, with the admin and the stated reason.
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} service.Impersonation
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/impersonations [get]
+func (h *ImpersonationHandler) GetImpersonations(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	impersonations, err := h.Impersonations.List(c, userID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to get impersonations")
+		return
+	}
+
+	c.JSON(http.StatusOK, impersonations)
+}
+
+// GetImpersonationRequests godoc
+// @Summary Audit log of an impersonation
+// @Description Lists the requests an admin made while impersonating the authenticated user in one session.
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {array} models.AuditLogEntry
+// @Failure 404 {object} map[string]interface{} "Impersonation session not found"
+// @Router /me/impersonations/{id} [get]
+func (h *ImpersonationHandler) GetImpersonationRequests(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	entries, err := h.Impersonations.Requests(c, userID, c.Param("id"))
+	if errors.Is(err, service.ErrImpersonationNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to get audit log")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
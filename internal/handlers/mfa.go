@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+	"pwa/pkg/jwt"
+)
+
+func NewMFAHandler(repo *repository.UserRepository, mfa *service.MFAService, tokens *service.TokenService, guard *service.LoginGuard) *MFAHandler {
+	return &MFAHandler{Repo: repo, MFA: mfa, Tokens: tokens, Guard: guard}
+}
+
+type MFAHandler struct {
+	Repo   *repository.UserRepository
+	MFA    *service.MFAService
+	Tokens *service.TokenService
+	Guard  *service.LoginGuard
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generates a new TOTP secret for the caller. It is not active until confirmed with a code.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} service.TOTPEnrollment
+// @Failure 409 {object} map[string]interface{} "Two-factor authentication already enabled"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/mfa/totp/enroll [post]
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.MFA.BeginEnrollment(c, user)
+	if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enables TOTP once the caller proves their authenticator app works, and returns single-use recovery codes.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "Code from the authenticator app"
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]interface{} "Invalid code or no pending enrollment"
+// @Failure 409 {object} map[string]interface{} "Two-factor authentication already enabled"
+// @Router /me/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var request models.MFACodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid confirmation data")
+		return
+	}
+
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	codes, err := h.MFA.ConfirmEnrollment(c, user, request.Code)
+	switch {
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrMFANotEnrolling):
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recoveryCodes": codes})
+}
+
+// DisableTOTP godoc
+// @Summary Disable TOTP
+// @Description Turns two-factor authentication off. Requires a current TOTP code or a recovery code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Invalid code or two-factor authentication not enabled"
+// @Router /me/mfa/totp [delete]
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var request models.MFACodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	err := h.MFA.Disable(c, user, request.Code)
+	if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnabled) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA godoc
+// @Summary Complete a two-step login
+// @Description Exchanges the mfaToken returned by /login and a TOTP or recovery code for an access and refresh token.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFALoginRequest true "Pending token and code"
+// @Success 200 {object} map[string]interface{} "Tokens"
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 401 {object} map[string]interface{} "Invalid token or code"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Router /login/mfa [post]
+func (h *MFAHandler) LoginMFA(c *gin.Context) {
+	var request models.MFALoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid login data")
+		return
+	}
+
+	claims, err := jwt.ValidateMFAPendingToken(request.MFAToken)
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := h.Repo.FindUserByID(c, claims.Subject)
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Login failed")
+		return
+	}
+
+	attempt := loginAttempt(c, user.Username, models.LoginMethodMFA, &user)
+	if !checkLoginAllowed(c, h.Guard, attempt) {
+		return
+	}
+
+	err = h.MFA.Verify(c, user, request.Code)
+	if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnabled) {
+		h.Guard.Failure(c, attempt, "invalid_code")
+		respondWithError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+
+	tokens, err := h.Tokens.Issue(c, user.ID.Hex(), sessionInfo(c, request.DeviceName))
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	h.Guard.Success(c, attempt)
+
+	respondWithTokens(c, http.StatusOK, "Login successful", tokens)
+}
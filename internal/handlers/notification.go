@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
 	"pwa/internal/models"
 	"pwa/internal/repository" // Ensure this import is correct
@@ -24,6 +25,14 @@ func (h *NotificationHandler) Subscribe(c *gin.Context) {
 		return
 	}
 
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		return
+	}
+	subscription.ID = primitive.NewObjectID()
+	subscription.UserID = userID
+
 	if _, err := h.Repo.CreateWebPushSubscription(c.Request.Context(), subscription); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe", "details": err.Error()})
 		return
@@ -35,6 +44,12 @@ func (h *NotificationHandler) Subscribe(c *gin.Context) {
 func (h *NotificationHandler) Unsubscribe(c *gin.Context) {
 	subscriptionID := c.Param("id")
 
+	subscription, err := h.Repo.FindWebPushSubscriptionByID(c.Request.Context(), subscriptionID)
+	if err != nil || subscription.UserID.Hex() != c.GetString("userID") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
 	if _, err := h.Repo.DeleteWebPushSubscription(c.Request.Context(), subscriptionID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe", "details": err.Error()})
 		return
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+	"pwa/pkg/jwt"
+)
+
+func NewOIDCHandler(oidc *service.OIDCService, tokens *service.TokenService, guard *service.LoginGuard) *OIDCHandler {
+	return &OIDCHandler{OIDC: oidc, Tokens: tokens, Guard: guard}
+}
+
+type OIDCHandler struct {
+	OIDC   *service.OIDCService
+	Tokens *service.TokenService
+	Guard  *service.LoginGuard
+}
+
+// Login godoc
+// @Summary Start an OpenID Connect login
+// @Description Returns the identity provider URL to send the browser to. The provider redirects back to the PWA, which posts the code and state to /oidc/callback.
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} map[string]interface{} "authorizationUrl"
+// @Failure 502 {object} map[string]interface{} "Identity provider unavailable"
+// @Router /oidc/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.OIDC.BeginLogin(c)
+	if err != nil {
+		respondWithError(c, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorizationUrl": authURL})
+}
+
+// Callback godoc
+// @Summary Finish an OpenID Connect login
+// @Description Redeems the authorization code, links or creates the local account and answers like /login: with tokens, or with an MFA token to finish at /login/mfa when two-factor authentication is enabled.
+// @Tags oidc
+// @Accept json
+// @Produce json
+// @Param request body models.OIDCCallbackRequest true "Code and state from the provider redirect"
+// @Success 200 {object} map[string]interface{} "Tokens"
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 401 {object} map[string]interface{} "Invalid state or provider response"
+// @Failure 409 {object} map[string]interface{} "Matching local account is unverified"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Router /oidc/callback [post]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var request models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid callback data")
+		return
+	}
+
+	user, err := h.OIDC.FinishLogin(c, request.State, request.Code)
+	switch {
+	case errors.Is(err, service.ErrOIDCStateNotFound), errors.Is(err, service.ErrOIDCFailed):
+		respondWithError(c, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, service.ErrOIDCAccountUnverified):
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, service.ErrRegistrationClosed):
+		respondWithError(c, http.StatusForbidden, "No account is linked to this identity and registration is not open")
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, "Failed to complete login")
+		return
+	}
+
+	attempt := loginAttempt(c, user.Username, models.LoginMethodOIDC, &user)
+	if !checkLoginAllowed(c, h.Guard, attempt) {
+		return
+	}
+
+	// The provider only vouches for the first factor; a second one enabled
+	// here is still checked at /login/mfa, which also clears the counter.
+	if user.MFAEnabled() {
+		mfaToken, err := jwt.GenerateMFAPendingToken(user.ID.Hex())
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "mfaRequired": true, "mfaToken": mfaToken})
+		return
+	}
+
+	tokens, err := h.Tokens.Issue(c, user.ID.Hex(), sessionInfo(c, request.DeviceName))
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	h.Guard.Success(c, attempt)
+
+	respondWithTokens(c, http.StatusOK, "Login successful", tokens)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+	"pwa/pkg/passwordpolicy"
+)
+
+// respondWithPolicyError lists every password rule that failed, so the form
+// can show them all at once.
+func respondWithPolicyError(c *gin.Context, err *passwordpolicy.Error) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Password does not meet the password policy", "violations": err.Violations})
+}
+
+func NewPasswordHandler(resets *service.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{Resets: resets}
+}
+
+type PasswordHandler struct {
+	Resets *service.PasswordResetService
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mails a single-use reset link to the account matching the username or email. Always answers 202 so accounts cannot be probed.
+// @Tags password
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Username or email"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Router /password/forgot [post]
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	if err := h.Resets.RequestReset(c, request.Identifier); err != nil {
+		log.Printf("Failed to send password reset: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Sets a new password with a token from a reset email. Every session of the account is signed out.
+// @Tags password
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Invalid or expired token"
+// @Failure 422 {object} map[string]interface{} "Password rejected by the password policy"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /password/reset [post]
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	err := h.Resets.ResetPassword(c, request.Token, request.Password)
+	var policyErr *passwordpolicy.Error
+	if errors.Is(err, service.ErrInvalidResetToken) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if errors.As(err, &policyErr) {
+		respondWithPolicyError(c, policyErr)
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"log"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+	"pwa/pkg/avatar"
+	"strconv"
+	"strings"
+)
+
+func NewProfileHandler(profiles *service.ProfileService) *ProfileHandler {
+	return &ProfileHandler{Profiles: profiles}
+}
+
+type ProfileHandler struct {
+	Profiles *service.ProfileService
+}
+
+// respondWithProfileError maps validation failures to 400 and everything
+// else to the given fallback message.
+func respondWithProfileError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrProfileNotFound):
+		respondWithError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidDisplayName), errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidLocale):
+		respondWithError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, avatar.ErrTooLarge):
+		respondWithError(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		respondWithError(c, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, avatar.ErrInvalidImage):
+		respondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		respondWithError(c, http.StatusInternalServerError, fallback)
+	}
+}
+
+// GetProfile godoc
+// @Summary Get my profile
+// @Description Returns the authenticated user's profile: display name, avatar, timezone and locale.
+// @Tags profiles
+// @Produce json
+// @Success 200 {object} models.Profile
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Router /me/profile [get]
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	profile, err := h.Profiles.Get(c, userID)
+	if err != nil {
+		respondWithProfileError(c, err, "Failed to get profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile godoc
+// @Summary Update my profile
+// @Description Changes the display name, IANA timezone or BCP 47 locale of the authenticated user. Omitted fields are left untouched and empty strings clear them.
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Param request body models.UpdateProfileRequest true "Profile fields"
+// @Success 200 {object} models.Profile
+// @Failure 400 {object} map[string]interface{} "Invalid display name, timezone or locale"
+// @Router /me/profile [put]
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	var request models.UpdateProfileRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid data: "+err.Error())
+		return
+	}
+
+	profile, err := h.Profiles.Update(c, userID, request)
+	if err != nil {
+		respondWithProfileError(c, err, "Failed to update profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UploadAvatar godoc
+// @Summary Upload my avatar
+// @Description Replaces the authenticated user's avatar. The image type is detected from its content; JPEG, PNG, GIF and WebP are accepted. The image is cropped to a square, resized and stored as PNG.
+// @Tags profiles
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} models.Profile
+// @Failure 400 {object} map[string]interface{} "Missing or undecodable image"
+// @Failure 413 {object} map[string]interface{} "Image too large"
+// @Failure 415 {object} map[string]interface{} "Unsupported image type"
+// @Router /me/avatar [put]
+func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "An avatar file is required")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "An avatar file is required")
+		return
+	}
+	defer file.Close()
+
+	profile, err := h.Profiles.SetAvatar(c, userID, file)
+	if err != nil {
+		respondWithProfileError(c, err, "Failed to save avatar")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteAvatar godoc
+// @Summary Remove my avatar
+// @Tags profiles
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /me/avatar [delete]
+func (h *ProfileHandler) DeleteAvatar(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if err := h.Profiles.RemoveAvatar(c, userID); err != nil {
+		respondWithProfileError(c, err, "Failed to remove avatar")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed"})
+}
+
+// GetAvatar godoc
+// @Summary Get a user's avatar
+// @Description Serves the user's avatar image. The avatarUrl of a profile carries a version parameter, so responses may be cached for a long time.
+// @Tags profiles
+// @Produce png
+// @Param id path string true "User ID"
+// @Success 200 {file} binary
+// @Failure 404 {object} map[string]interface{} "No avatar"
+// @Router /users/{id}/avatar [get]
+func (h *ProfileHandler) GetAvatar(c *gin.Context) {
+	stream, err := h.Profiles.OpenAvatar(c, c.Param("id"))
+	if errors.Is(err, service.ErrAvatarNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to open avatar")
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", avatar.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(stream.GetFile().Length, 10))
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, stream); err != nil {
+		log.Printf("Failed to send avatar of user %s: %v", c.Param("id"), err)
+	}
+}
+
+// GetPublicProfile godoc
+// @Summary Get a user's public profile
+// @Description Returns the username, display name and avatar of a user. Email addresses are never included.
+// @Tags profiles
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.PublicProfile
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Router /users/{id}/profile [get]
+func (h *ProfileHandler) GetPublicProfile(c *gin.Context) {
+	profile, err := h.Profiles.PublicProfile(c, c.Param("id"))
+	if err != nil {
+		respondWithProfileError(c, err, "Failed to get profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetPublicProfiles godoc
+// @Summary Get several public profiles
+// @Description Resolves up to 100 user IDs, e.g. the members of a channel or the authors of tasks, to public profiles. Unknown IDs are skipped.
+// @Tags profiles
+// @Produce json
+// @Param ids query string true "Comma separated user IDs"
+// @Success 200 {array} models.PublicProfile
+// @Failure 400 {object} map[string]interface{} "Too many IDs"
+// @Router /users/profiles [get]
+func (h *ProfileHandler) GetPublicProfiles(c *gin.Context) {
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	profiles, err := h.Profiles.PublicProfiles(c, ids)
+	if errors.Is(err, service.ErrTooManyProfiles) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to get profiles")
+		return
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+// GetDirectory godoc
+// @Summary Search the user directory
+// @Description Lists public profiles ordered by username, e.g. for a member picker. q filters on a case-insensitive prefix of the username or display name. Pass the returned nextCursor to get the following page.
+// @Tags profiles
+// @Produce json
+// @Param q query string false "Username or display name prefix"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Page size, 1 to 50 (default 20)"
+// @Success 200 {object} models.DirectoryPage
+// @Failure 400 {object} map[string]interface{} "Invalid query, cursor or limit"
+// @Router /users/directory [get]
+func (h *ProfileHandler) GetDirectory(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondWithError(c, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := h.Profiles.Directory(c, c.Query("q"), c.Query("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidQuery) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to search users")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/service"
+)
+
+func NewRegistrationHandler(registration *service.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{Registration: registration}
+}
+
+type RegistrationHandler struct {
+	Registration *service.RegistrationService
+}
+
+// GetRegistration godoc
+// @Summary Registration mode
+// @Description Tells clients whether they can register freely (open), need an invite code (invite_only) or cannot register at all (closed).
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /registration [get]
+func (h *RegistrationHandler) GetRegistration(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mode": h.Registration.Mode()})
+}
+
+// CreateInvite godoc
+// @Summary Create an invite code
+// @Description Issues a code that lets someone register while registration is invite-only. The code can be limited in uses, expire, be locked to one email address and add the new user to channels. It is only shown in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.CreateInviteCodeRequest true "Invite settings"
+// @Success 201 {object} map[string]interface{} "code and its metadata"
+// @Failure 400 {object} map[string]interface{} "Invalid expiry, email or channel"
+// @Router /admin/invites [post]
+func (h *RegistrationHandler) CreateInvite(c *gin.Context) {
+	var request models.CreateInviteCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid invite data")
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	invite, code, err := h.Registration.CreateInvite(c, adminID, request)
+	if errors.Is(err, service.ErrInvalidInvite) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to create invite code")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": code, "invite": invite})
+}
+
+// GetInvites godoc
+// @Summary List invite codes
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.InviteCode
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /admin/invites [get]
+func (h *RegistrationHandler) GetInvites(c *gin.Context) {
+	invites, err := h.Registration.ListInvites(c)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to retrieve invite codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInvite godoc
+// @Summary Revoke an invite code
+// @Tags admin
+// @Produce json
+// @Param id path string true "Invite code ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Invite code not found"
+// @Router /admin/invites/{id} [delete]
+func (h *RegistrationHandler) RevokeInvite(c *gin.Context) {
+	err := h.Registration.RevokeInvite(c, c.Param("id"))
+	if errors.Is(err, service.ErrInviteCodeNotFound) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to revoke invite code")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite code revoked"})
+}
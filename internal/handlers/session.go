@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+)
+
+func NewSessionHandler(repo *repository.SessionRepository, tokens *service.TokenService) *SessionHandler {
+	return &SessionHandler{Repo: repo, Tokens: tokens}
+}
+
+type SessionHandler struct {
+	Repo   *repository.SessionRepository
+	Tokens *service.TokenService
+}
+
+// GetSessions godoc
+// @Summary List the caller's sessions
+// @Description Lists every device the caller is currently logged in on. The session making the request is flagged as current.
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} models.Session
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/sessions [get]
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	sessions, err := h.Repo.FindActiveSessionsByUserID(c, userID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to retrieve sessions")
+		return
+	}
+
+	currentID := c.GetString("sessionID")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == currentID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteSession godoc
+// @Summary Sign out a device
+// @Description Revokes one of the caller's sessions. Its access and refresh tokens stop working immediately.
+// @Tags sessions
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Session not found"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/sessions/{id} [delete]
+func (h *SessionHandler) DeleteSession(c *gin.Context) {
+	err := h.Tokens.RevokeSession(c, c.GetString("userID"), c.Param("id"))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		respondWithError(c, http.StatusNotFound, "Session not found")
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
@@ -1,24 +1,66 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
 	"net/http"
 	"pwa/internal/models"
 	"pwa/internal/repository"
 	"pwa/internal/service"
+	"strings"
 	"time"
 )
 
-func NewTodoListHandler(repo *repository.TodoListRepository) *TodoListHandler {
-	return &TodoListHandler{Repo: repo}
+func NewTodoListHandler(repo *repository.TodoListRepository, channels *repository.ChannelRepository) *TodoListHandler {
+	return &TodoListHandler{Repo: repo, Channels: channels}
 }
 
 type TodoListHandler struct {
 	Repo           *repository.TodoListRepository
+	Channels       *repository.ChannelRepository
 	WebPushService *service.WebPushService
 }
 
+// authorizeTodoList loads the list and checks that the caller may act on
+// it. Personal lists are only accessible to their owner; lists in a channel
+// follow the caller's role there, and members may edit lists they created.
+func (h *TodoListHandler) authorizeTodoList(c *gin.Context, id string, permission models.ChannelPermission) (models.TodoList, bool) {
+	todoList, err := h.Repo.FindTodoListByID(c, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "TodoList not found"})
+		return todoList, false
+	}
+
+	userID := c.GetString("userID")
+	if todoList.ChannelID == nil {
+		if todoList.Owner.Hex() != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this todo list"})
+			return todoList, false
+		}
+		return todoList, true
+	}
+
+	if permission == models.PermissionEditAnyTodoList && todoList.Owner.Hex() == userID {
+		permission = models.PermissionCreateTodoLists
+	}
+	_, ok := authorizeChannel(c, h.Channels, todoList.ChannelID.Hex(), permission)
+	return todoList, ok
+}
+
+// notifyChannel sends a push notification to the members of the list's
+// channel, if it has one.
+func (h *TodoListHandler) notifyChannel(c *gin.Context, todoList models.TodoList, message string) {
+	if h.WebPushService == nil || todoList.ChannelID == nil {
+		return
+	}
+	if err := h.WebPushService.NotifyChannelMembers(c, todoList.ChannelID.Hex(), message); err != nil {
+		log.Printf("Failed to notify channel %s: %v", todoList.ChannelID.Hex(), err)
+	}
+}
+
 func (h *TodoListHandler) CreateTodoList(c *gin.Context) {
 	var newTodoList models.TodoList
 	if err := c.ShouldBindJSON(&newTodoList); err != nil {
@@ -26,6 +68,21 @@ func (h *TodoListHandler) CreateTodoList(c *gin.Context) {
 		return
 	}
 
+	if newTodoList.ChannelID != nil {
+		if _, ok := authorizeChannel(c, h.Channels, newTodoList.ChannelID.Hex(), models.PermissionCreateTodoLists); !ok {
+			return
+		}
+	}
+
+	owner, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		return
+	}
+
+	newTodoList.ID = primitive.NewObjectID()
+	newTodoList.Owner = owner
+	newTodoList.Tasks = []models.Task{}
 	newTodoList.CreatedAt = time.Now()
 	newTodoList.UpdatedAt = time.Now()
 
@@ -39,10 +96,8 @@ func (h *TodoListHandler) CreateTodoList(c *gin.Context) {
 }
 
 func (h *TodoListHandler) GetTodoList(c *gin.Context) {
-	id := c.Param("id")
-	todoList, err := h.Repo.FindTodoListByID(c, id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "TodoList not found"})
+	todoList, ok := h.authorizeTodoList(c, c.Param("id"), models.PermissionViewChannel)
+	if !ok {
 		return
 	}
 
@@ -51,14 +106,23 @@ func (h *TodoListHandler) GetTodoList(c *gin.Context) {
 
 func (h *TodoListHandler) UpdateTodoList(c *gin.Context) {
 	id := c.Param("id")
-	var todoList models.TodoList
-	if err := c.ShouldBindJSON(&todoList); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := h.authorizeTodoList(c, id, models.PermissionEditAnyTodoList); !ok {
 		return
 	}
 
-	todoList.UpdatedAt = time.Now()
-	result, err := h.Repo.UpdateTodoList(c, id, todoList)
+	var request models.UpdateTodoListRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data: " + err.Error()})
+		return
+	}
+	if request.Title != nil && strings.TrimSpace(*request.Title) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title cannot be empty"})
+		return
+	}
+
+	result, err := h.Repo.UpdateTodoList(c, id, request)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -69,6 +133,10 @@ func (h *TodoListHandler) UpdateTodoList(c *gin.Context) {
 
 func (h *TodoListHandler) DeleteTodoList(c *gin.Context) {
 	id := c.Param("id")
+	if _, ok := h.authorizeTodoList(c, id, models.PermissionEditAnyTodoList); !ok {
+		return
+	}
+
 	result, err := h.Repo.DeleteTodoList(c, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -80,17 +148,48 @@ func (h *TodoListHandler) DeleteTodoList(c *gin.Context) {
 
 func (h *TodoListHandler) GetTodoListsByUserID(c *gin.Context) {
 	userID := c.Param("id")
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	channels, err := h.Channels.FindChannelsByUserID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	todoLists, err := h.Repo.FindTodoListsByUserID(c, userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "TodoLists not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, todoLists)
+	c.JSON(http.StatusOK, memberTodoLists(todoLists, channels))
+}
+
+// memberTodoLists keeps personal lists and lists in the given channels.
+// Lists in channels the user has left or was removed from stay with the
+// channel, so they are dropped.
+func memberTodoLists(todoLists []models.TodoList, channels []models.Channel) []models.TodoList {
+	member := make(map[primitive.ObjectID]bool, len(channels))
+	for _, channel := range channels {
+		member[channel.ID] = true
+	}
+	visible := make([]models.TodoList, 0, len(todoLists))
+	for _, todoList := range todoLists {
+		if todoList.ChannelID == nil || member[*todoList.ChannelID] {
+			visible = append(visible, todoList)
+		}
+	}
+	return visible
 }
 
 func (h *TodoListHandler) GetTodoListByChannelID(c *gin.Context) {
 	channelID := c.Param("id")
+	if _, ok := authorizeChannel(c, h.Channels, channelID, models.PermissionViewChannel); !ok {
+		return
+	}
+
 	todoLists, err := h.Repo.FindTodoListsByChannelID(c, channelID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "TodoLists not found"})
@@ -108,18 +207,25 @@ func (h *TodoListHandler) AddTask(c *gin.Context) {
 		return
 	}
 
+	if _, ok := h.authorizeTodoList(c, todoListID, models.PermissionEditTasks); !ok {
+		return
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	task.ID = primitive.NewObjectID()
 	task.CreatedAt = time.Now()
 	task.UpdatedAt = time.Now()
+	task.UpdatedBy = userID
 
 	if err := h.Repo.AddTaskToList(c, todoListID, task); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Task added"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Task added", "id": task.ID})
 }
 
 func (h *TodoListHandler) UpdateTask(c *gin.Context) {
-	todoListID := c.Param("todoListId")
+	todoListID := c.Param("id")
 	taskID := c.Param("taskId")
 	var task models.Task
 	if err := c.ShouldBindJSON(&task); err != nil {
@@ -127,13 +233,21 @@ func (h *TodoListHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
-	task.UpdatedAt = time.Now()
-
-	oldTask, err := h.Repo.GetTaskByID(c, todoListID, taskID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+	todoList, ok := h.authorizeTodoList(c, todoListID, models.PermissionEditTasks)
+	if !ok {
 		return
 	}
+	oldTask, found := todoList.FindTask(taskID)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	task.ID = oldTask.ID
+	task.CreatedAt = oldTask.CreatedAt
+	task.UpdatedAt = time.Now()
+	task.UpdatedBy = userID
 
 	if err := h.Repo.UpdateTask(c, todoListID, taskID, task); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -141,23 +255,23 @@ func (h *TodoListHandler) UpdateTask(c *gin.Context) {
 	}
 
 	if oldTask.Completed != task.Completed {
-		message := fmt.Sprintf("Task '%s' has been marked as %v.", task.Title, task.Completed)
-		err := h.WebPushService.NotifyChannelMembers(c, todoListID, message)
-		if err != nil {
-			return
-		}
+		h.notifyChannel(c, todoList, fmt.Sprintf("Task '%s' has been marked as %v.", task.Title, task.Completed))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Task updated"})
 }
 
 func (h *TodoListHandler) DeleteTask(c *gin.Context) {
-	todoListID := c.Param("todoListId")
+	todoListID := c.Param("id")
 	taskID := c.Param("taskId")
 
-	task, err := h.Repo.GetTaskByID(c, todoListID, taskID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+	todoList, ok := h.authorizeTodoList(c, todoListID, models.PermissionEditTasks)
+	if !ok {
+		return
+	}
+	task, found := todoList.FindTask(taskID)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
@@ -166,11 +280,7 @@ func (h *TodoListHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
-	message := fmt.Sprintf("Task '%s' has been deleted.", task.Title)
-	err = h.WebPushService.NotifyChannelMembers(c, todoListID, message)
-	if err != nil {
-		return
-	}
+	h.notifyChannel(c, todoList, fmt.Sprintf("Task '%s' has been deleted.", task.Title))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
 }
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"pwa/internal/models"
+	"testing"
+)
+
+func TestMemberTodoListsDropsListsOfLeftChannels(t *testing.T) {
+	joined := models.Channel{ID: primitive.NewObjectID()}
+	left := primitive.NewObjectID()
+	personal := models.TodoList{ID: primitive.NewObjectID(), Title: "personal"}
+	shared := models.TodoList{ID: primitive.NewObjectID(), Title: "shared", ChannelID: &joined.ID}
+	abandoned := models.TodoList{ID: primitive.NewObjectID(), Title: "abandoned", ChannelID: &left}
+
+	visible := memberTodoLists([]models.TodoList{personal, shared, abandoned}, []models.Channel{joined})
+
+	if len(visible) != 2 || visible[0].ID != personal.ID || visible[1].ID != shared.ID {
+		titles := make([]string, len(visible))
+		for i, todoList := range visible {
+			titles[i] = todoList.Title
+		}
+		t.Fatalf("got lists %v, want [personal shared]", titles)
+	}
+}
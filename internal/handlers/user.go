@@ -1,59 +1,96 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
 	"pwa/internal/models"
 	"pwa/internal/repository"
+	"pwa/internal/service"
 	"pwa/pkg/jwt"
+	"pwa/pkg/passwordhash"
+	"pwa/pkg/passwordpolicy"
+	"strings"
 	"time"
 	_ "time"
 )
 
-func NewUserHandler(repo *repository.UserRepository) *UserHandler {
-	return &UserHandler{Repo: repo}
+func NewUserHandler(repo *repository.UserRepository, tokens *service.TokenService, verification *service.EmailVerificationService, guard *service.LoginGuard, policy *passwordpolicy.Policy, deletion *service.AccountDeletionService, registration *service.RegistrationService) *UserHandler {
+	return &UserHandler{Repo: repo, Tokens: tokens, Verification: verification, Guard: guard, Policy: policy, Deletion: deletion, Registration: registration}
 }
 
 type UserHandler struct {
-	Repo *repository.UserRepository
+	Repo         *repository.UserRepository
+	Tokens       *service.TokenService
+	Verification *service.EmailVerificationService
+	Guard        *service.LoginGuard
+	Policy       *passwordpolicy.Policy
+	Deletion     *service.AccountDeletionService
+	Registration *service.RegistrationService
 }
 
 // CreateUser godoc
 // @Summary Create a new user
-// @Description Adds a new user to the system with the provided information.
+// @Description Adds a new user to the system with the provided information. While REGISTRATION_MODE is invite_only a valid invite code is required, and while it is closed nobody can register.
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User data"
+// @Param user body models.RegisterRequest true "User data"
 // @Success 201 {object} map[string]interface{} "Successful creation with new user ID"
 // @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 403 {object} map[string]interface{} "Registration is closed, or the invite code is missing or invalid"
+// @Failure 422 {object} map[string]interface{} "Password rejected by the password policy"
 // @Failure 500 {object} map[string]interface{} "Internal Server Error"
 // @Router /users [post]
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var newUser models.User
-	if err := c.ShouldBindJSON(&newUser); err != nil {
+	var request models.RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		respondWithError(c, http.StatusBadRequest, "Invalid user data")
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
+	if !h.checkPassword(c, request.Password, request.Username, request.Email) {
+		return
+	}
+
+	invite, err := h.Registration.Admit(c, request.Email, request.InviteCode)
+	if errors.Is(err, service.ErrRegistrationClosed) || errors.Is(err, service.ErrInviteCodeRequired) || errors.Is(err, service.ErrInvalidInviteCode) {
+		respondWithError(c, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to register user")
+		return
+	}
+
+	hashedPassword, err := passwordhash.Hash(request.Password)
 	if err != nil {
+		h.Registration.Abort(c, invite)
 		respondWithError(c, http.StatusInternalServerError, "Failed to process password")
 		return
 	}
-	newUser.Password = string(hashedPassword)
-	newUser.CreatedAt = time.Now()
-	newUser.UpdatedAt = time.Now()
+	newUser := models.User{
+		Username:  request.Username,
+		Email:     request.Email,
+		Password:  hashedPassword,
+		Role:      models.RoleUser,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
 
 	result, err := h.Repo.CreateUser(c, newUser)
 	if mongo.IsDuplicateKeyError(err) {
+		h.Registration.Abort(c, invite)
 		respondWithError(c, http.StatusBadRequest, "Username or email already exists")
 		return
 	} else if err != nil {
+		h.Registration.Abort(c, invite)
 		respondWithError(c, http.StatusInternalServerError, "Failed to register user")
 		return
 	}
@@ -64,22 +101,149 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	token, err := jwt.GenerateToken(objID.Hex())
+	newUser.ID = objID
+	h.Registration.Complete(c, invite, objID)
+	if err := h.Verification.SendVerification(c, newUser); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", objID.Hex(), err)
+	}
+
+	tokens, err := h.Tokens.Issue(c, objID.Hex(), sessionInfo(c, ""))
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "token": token})
+	respondWithTokens(c, http.StatusCreated, "User created successfully", tokens)
+}
+
+// upgradePasswordHash replaces a bcrypt hash, or an argon2id hash made with
+// outdated parameters, once the plaintext is known to be right.
+func (h *UserHandler) upgradePasswordHash(c *gin.Context, user models.User, password string) {
+	hashedPassword, err := passwordhash.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %s: %v", user.ID.Hex(), err)
+		return
+	}
+	if err := h.Repo.ReplacePasswordHash(c, user.ID, user.Password, hashedPassword); err != nil {
+		log.Printf("Failed to store rehashed password of user %s: %v", user.ID.Hex(), err)
+	}
 }
 
 func respondWithError(c *gin.Context, code int, message string) {
 	c.JSON(code, gin.H{"error": message})
 }
 
+// recentSignIns is the part of service.TokenService that confirmIdentity
+// needs.
+type recentSignIns interface {
+	RecentlySignedIn(ctx context.Context, sessionID string) (bool, error)
+}
+
+// confirmIdentity checks that the caller is the account holder before a
+// sensitive change: by password, or for accounts without one (e.g. created
+// through OIDC) by a login within the last few minutes. It responds and
+// returns false when the check fails.
+func confirmIdentity(c *gin.Context, tokens recentSignIns, user models.User, password, action string) bool {
+	if user.Password != "" {
+		if ok, _, _ := passwordhash.Verify(password, user.Password); !ok {
+			respondWithError(c, http.StatusUnauthorized, "Password is incorrect")
+			return false
+		}
+		return true
+	}
+
+	recent, err := tokens.RecentlySignedIn(c, c.GetString("sessionID"))
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to check session")
+		return false
+	}
+	if !recent {
+		respondWithError(c, http.StatusUnauthorized, "Sign in again to "+action)
+		return false
+	}
+	return true
+}
+
+// checkPassword runs the password policy, responding with the violations
+// and returning false when the password is rejected.
+func (h *UserHandler) checkPassword(c *gin.Context, password, username, email string) bool {
+	err := h.Policy.Check(password, username, email)
+	var policyErr *passwordpolicy.Error
+	if errors.As(err, &policyErr) {
+		respondWithPolicyError(c, policyErr)
+		return false
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to check password")
+		return false
+	}
+	return true
+}
+
+// canManageUser reports whether the caller may act on the account with the
+// given hex ID: their own, or any account for admins.
+func canManageUser(c *gin.Context, userID string) bool {
+	return userID == c.GetString("userID") || c.GetString("role") == models.RoleAdmin
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirms the email address of an account with the token from the verification link sent at signup.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Invalid or expired token"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /users/verify [post]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var request models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid verification data")
+		return
+	}
+
+	err := h.Verification.Verify(c, request.Token)
+	if errors.Is(err, service.ErrInvalidVerificationToken) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Tags users
+// @Produce json
+// @Success 202 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Email already verified"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/verify/resend [post]
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	err := h.Verification.SendVerification(c, user)
+	if errors.Is(err, service.ErrAlreadyVerified) {
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
 // GetUsers godoc
 // @Summary Get all users
-// @Description Retrieves a list of all users in the system.
+// @Description Retrieves a list of all users in the system. Admin only. Use /users/directory to look up other users as a regular user.
 // @Tags users
 // @Produce json
 // @Success 200 {array} models.User
@@ -97,11 +261,12 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 
 // GetUser godoc
 // @Summary Get a user by ID
-// @Description Retrieves a user by their unique identifier.
+// @Description Retrieves a user by their unique identifier. Users can only read their own account unless they are an admin.
 // @Tags users
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} models.User
+// @Failure 403 {object} ErrorResponse "Not allowed to read this user"
 // @Failure 404 {object} ErrorResponse "User not found"
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUser(c *gin.Context) {
@@ -111,74 +276,256 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found: " + err.Error()})
 		return
 	}
+	if !canManageUser(c, user.ID.Hex()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
 
+	user.Password = ""
 	c.JSON(http.StatusOK, user)
 }
 
 // UpdateUser godoc
 // @Summary Update a user
-// @Description Updates a user's information with the provided data.
+// @Description Updates the username, email or password of an account. Only the owner or an admin may update an account, and changing the email or password of your own account requires the current password. A new email has to be verified again.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
-// @Param user body User true "User update data"
-// @Success 200 {object}
+// @Param user body models.UpdateUserRequest true "User update data"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} ErrorResponse "Bad request when the JSON data is invalid"
+// @Failure 401 {object} ErrorResponse "Current password is wrong or sign-in too old"
+// @Failure 403 {object} ErrorResponse "Not allowed to update this user"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "Username or email already in use"
+// @Failure 422 {object} ErrorResponse "Password rejected by the password policy"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /users/{id} [put]
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	userID := c.Param("id")
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	if !canManageUser(c, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	// Unknown keys are rejected rather than ignored, so clients notice when
+	// they try to change a field that is not editable here.
+	var request models.UpdateUserRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data: " + err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
 		return
 	}
 
-	updateDoc := bson.M{"$set": bson.M{}}
-	for key, value := range updateData {
-		updateDoc["$set"].(bson.M)[key] = value
-		if key == "password" {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(value.(string)), bcrypt.DefaultCost)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
-				return
-			}
-			updateDoc["$set"].(bson.M)[key] = string(hashedPassword)
+	user, err := h.Repo.FindUserByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	emailChanged := false
+
+	if request.Password != nil || request.Email != nil {
+		// Admins managing someone else's account do not know their password.
+		if user.ID.Hex() == c.GetString("userID") && !confirmIdentity(c, h.Tokens, user, request.CurrentPassword, "change your email or password") {
+			return
 		}
 	}
-	updateDoc["$set"].(bson.M)["updatedAt"] = time.Now()
 
-	objID, _ := primitive.ObjectIDFromHex(userID)
-	filter := bson.M{"_id": objID}
-	result, err := h.Repo.UpdateUser(c, filter, updateDoc)
-	if err != nil {
+	if request.Username != nil && *request.Username != user.Username {
+		username := strings.TrimSpace(*request.Username)
+		if username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username cannot be empty"})
+			return
+		}
+		if !h.ensureIdentifierAvailable(c, username, user.ID) {
+			return
+		}
+		set["username"] = username
+	}
+
+	if request.Email != nil && *request.Email != user.Email {
+		if !h.ensureIdentifierAvailable(c, *request.Email, user.ID) {
+			return
+		}
+		set["email"] = *request.Email
+		set["verified"] = false
+		unset["verifiedAt"] = ""
+		emailChanged = true
+	}
+
+	if request.Password != nil {
+		username, email := user.Username, user.Email
+		if value, ok := set["username"].(string); ok {
+			username = value
+		}
+		if value, ok := set["email"].(string); ok {
+			email = value
+		}
+		if !h.checkPassword(c, *request.Password, username, email) {
+			return
+		}
+
+		hashedPassword, err := passwordhash.Hash(*request.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+			return
+		}
+		set["password"] = hashedPassword
+	}
+
+	if len(set) == 0 {
+		c.JSON(http.StatusOK, gin.H{"result": 0})
+		return
+	}
+	set["updatedAt"] = time.Now()
+
+	updateDoc := bson.M{"$set": set}
+	if len(unset) > 0 {
+		updateDoc["$unset"] = unset
+	}
+	result, err := h.Repo.UpdateUser(c, bson.M{"_id": user.ID}, updateDoc)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	if emailChanged {
+		user.Email = *request.Email
+		user.Verified = false
+		if err := h.Verification.SendVerification(c, user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"result": result.ModifiedCount})
 }
 
+// ensureIdentifierAvailable responds with 409 and returns false when value
+// is already the username or email of another account. Both fields are
+// checked because either one can be used to log in.
+func (h *UserHandler) ensureIdentifierAvailable(c *gin.Context, value string, self primitive.ObjectID) bool {
+	existing, err := h.Repo.FindUserByIdentifier(c, value)
+	if err == nil && existing.ID != self {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+		return false
+	} else if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return false
+	}
+	return true
+}
+
 // DeleteUser godoc
 // @Summary Delete a user
-// @Description Removes a user from the system.
+// @Description Removes a user from the system right away, together with their sessions, tokens, push subscriptions and channel memberships. Admin only.
 // @Tags users
 // @Param id path string true "User ID"
 // @Success 200 {object}
+// @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	result, err := h.Repo.DeleteUser(c, id)
+	user, err := h.Repo.FindUserByID(c, c.Param("id"))
 	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.Deletion.Delete(c, user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"deleted_count": result.DeletedCount})
+	c.JSON(http.StatusOK, gin.H{"deleted_count": 1})
+}
+
+// ScheduleDeletion godoc
+// @Summary Delete your account
+// @Description Schedules deletion of the caller's account after a grace period. Accounts with a password must confirm it; accounts without one (single sign-on or passkey only) must have signed in within the last few minutes.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.ScheduleDeletionRequest true "Current password"
+// @Success 202 {object} map[string]interface{} "When the account will be deleted"
+// @Failure 401 {object} map[string]interface{} "Wrong password or sign-in too old"
+// @Failure 409 {object} map[string]interface{} "Deletion already scheduled"
+// @Router /me/deletion [post]
+func (h *UserHandler) ScheduleDeletion(c *gin.Context) {
+	var request models.ScheduleDeletionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+	if !confirmIdentity(c, h.Tokens, user, request.Password, "confirm account deletion") {
+		return
+	}
+
+	at, err := h.Deletion.Schedule(c, user)
+	if errors.Is(err, service.ErrDeletionAlreadyScheduled) {
+		respondWithError(c, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to schedule deletion")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Account deletion scheduled", "deletionScheduledAt": at})
 }
 
+// CancelDeletion godoc
+// @Summary Cancel account deletion
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "No deletion scheduled"
+// @Router /me/deletion [delete]
+func (h *UserHandler) CancelDeletion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondWithError(c, http.StatusUnauthorized, "Invalid user")
+		return
+	}
+
+	err = h.Deletion.Cancel(c, userID)
+	if errors.Is(err, service.ErrDeletionNotScheduled) {
+		respondWithError(c, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to cancel deletion")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// LoginUser godoc
+// @Summary Log in with a password
+// @Description Checks a username or email and password. Repeated failures are slowed down and eventually lock the account for a while; the owner is mailed an unlock link.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.LoginRequest true "Credentials"
+// @Success 200 {object} map[string]interface{} "Tokens, or an mfaToken when two-factor authentication is required"
+// @Failure 401 {object} map[string]interface{} "Invalid credentials"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Router /login [post]
 func (h *UserHandler) LoginUser(c *gin.Context) {
 	var loginDetails models.LoginRequest
 	if err := c.ShouldBindJSON(&loginDetails); err != nil {
@@ -186,23 +533,86 @@ func (h *UserHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
+	var account *models.User
 	user, err := h.Repo.FindUserByIdentifier(c, loginDetails.Identifier)
-	if err != nil {
+	if err == nil {
+		account = &user
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	attempt := loginAttempt(c, loginDetails.Identifier, models.LoginMethodPassword, account)
+	if !checkLoginAllowed(c, h.Guard, attempt) {
+		return
+	}
+
+	if account == nil {
+		h.Guard.Failure(c, attempt, "unknown_user")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginDetails.Password))
-	if err != nil {
+	ok, rehash, err := passwordhash.Verify(loginDetails.Password, user.Password)
+	if !ok {
+		if err != nil && !errors.Is(err, passwordhash.ErrUnknownFormat) {
+			log.Printf("Failed to verify password of user %s: %v", user.ID.Hex(), err)
+		}
+		h.Guard.Failure(c, attempt, "invalid_password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if rehash {
+		h.upgradePasswordHash(c, user, loginDetails.Password)
+	}
 
-	token, err := jwt.GenerateToken(user.ID.Hex())
+	// The counter is only cleared once the second factor has been checked
+	// too, so a known password cannot be used to keep guessing codes.
+	if user.MFAEnabled() {
+		mfaToken, err := jwt.GenerateMFAPendingToken(user.ID.Hex())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "mfaRequired": true, "mfaToken": mfaToken})
+		return
+	}
+
+	tokens, err := h.Tokens.Issue(c, user.ID.Hex(), sessionInfo(c, loginDetails.DeviceName))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	h.Guard.Success(c, attempt)
+
+	respondWithTokens(c, http.StatusOK, "Login successful", tokens)
+}
+
+// UnlockAccount godoc
+// @Summary Unlock an account
+// @Description Lifts a login lockout, including that of the client IPs the failed attempts came from, with the single-use token from the email sent when the account was locked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.UnlockAccountRequest true "Unlock token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{} "Invalid, expired or already used token"
+// @Router /login/unlock [post]
+func (h *UserHandler) UnlockAccount(c *gin.Context) {
+	var request models.UnlockAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid unlock data")
+		return
+	}
+
+	err := h.Guard.Unlock(c, request.Token)
+	if errors.Is(err, service.ErrInvalidUnlockToken) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to unlock account")
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": token})
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
 }
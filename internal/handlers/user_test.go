@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"pwa/internal/models"
+	"testing"
+)
+
+type fakeSignIns struct {
+	recent    bool
+	sessionID string
+}
+
+func (f *fakeSignIns) RecentlySignedIn(_ context.Context, sessionID string) (bool, error) {
+	f.sessionID = sessionID
+	return f.recent, nil
+}
+
+func TestConfirmIdentityWithoutPasswordRequiresRecentSignIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{Username: "oidc-user"}
+
+	for _, recent := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/users/1", nil)
+		c.Set("sessionID", "session-1")
+		tokens := &fakeSignIns{recent: recent}
+
+		ok := confirmIdentity(c, tokens, user, "", "change your email or password")
+		if ok != recent {
+			t.Fatalf("recent sign-in %v: confirmIdentity returned %v", recent, ok)
+		}
+		if tokens.sessionID != "session-1" {
+			t.Fatalf("checked session %q, want session-1", tokens.sessionID)
+		}
+		if !recent && w.Code != http.StatusUnauthorized {
+			t.Fatalf("stale sign-in: got status %d, want 401", w.Code)
+		}
+	}
+}
+
+func TestConfirmIdentityChecksPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/users/1", nil)
+	tokens := &fakeSignIns{recent: true}
+	user := models.User{Username: "alice", Password: "not-a-hash"}
+
+	if confirmIdentity(c, tokens, user, "guess", "change your email or password") {
+		t.Fatal("wrong password was accepted")
+	}
+	if w.Code != http.StatusUnauthorized || tokens.sessionID != "" {
+		t.Fatalf("got status %d and session check %q, want 401 without a session check", w.Code, tokens.sessionID)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/internal/service"
+	"time"
+)
+
+func NewWebAuthnHandler(repo *repository.UserRepository, webAuthn *service.WebAuthnService, tokens *service.TokenService) *WebAuthnHandler {
+	return &WebAuthnHandler{Repo: repo, WebAuthn: webAuthn, Tokens: tokens}
+}
+
+type WebAuthnHandler struct {
+	Repo     *repository.UserRepository
+	WebAuthn *service.WebAuthnService
+	Tokens   *service.TokenService
+}
+
+type passkeyResponse struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Transports   []string   `json:"transports,omitempty"`
+	Synced       bool       `json:"synced"`
+	CloneWarning bool       `json:"cloneWarning"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func newPasskeyResponse(passkey models.WebAuthnCredential) passkeyResponse {
+	return passkeyResponse{
+		ID:           base64.RawURLEncoding.EncodeToString(passkey.ID),
+		Name:         passkey.Name,
+		Transports:   passkey.Transports,
+		Synced:       passkey.BackupState,
+		CloneWarning: passkey.CloneWarning,
+		CreatedAt:    passkey.CreatedAt,
+		LastUsedAt:   passkey.LastUsedAt,
+	}
+}
+
+// BeginRegistration godoc
+// @Summary Start passkey registration
+// @Description Returns PublicKeyCredentialCreationOptions for navigator.credentials.create() and the challenge ID to finish with.
+// @Tags webauthn
+// @Produce json
+// @Success 200 {object} map[string]interface{} "challengeId and options"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/webauthn/register/begin [post]
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	options, challengeID, err := h.WebAuthn.BeginRegistration(c, user)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to start passkey registration")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challengeId": challengeID, "options": options})
+}
+
+// FinishRegistration godoc
+// @Summary Finish passkey registration
+// @Description Verifies the authenticator response and stores the passkey on the caller's account.
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body models.WebAuthnRegistrationRequest true "Challenge ID, passkey name and PublicKeyCredential"
+// @Success 201 {object} passkeyResponse
+// @Failure 400 {object} map[string]interface{} "Invalid challenge or credential"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /me/webauthn/register/finish [post]
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	var request models.WebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid registration data")
+		return
+	}
+
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	passkey, err := h.WebAuthn.FinishRegistration(c, user, request.ChallengeID, request.Name, bytes.NewReader(request.Credential))
+	if errors.Is(err, service.ErrWebAuthnChallengeNotFound) || errors.Is(err, service.ErrWebAuthnFailed) {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to register passkey")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newPasskeyResponse(passkey))
+}
+
+// GetPasskeys godoc
+// @Summary List the caller's passkeys
+// @Tags webauthn
+// @Produce json
+// @Success 200 {array} passkeyResponse
+// @Router /me/webauthn/credentials [get]
+func (h *WebAuthnHandler) GetPasskeys(c *gin.Context) {
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	passkeys := make([]passkeyResponse, 0, len(user.Passkeys))
+	for _, passkey := range user.Passkeys {
+		passkeys = append(passkeys, newPasskeyResponse(passkey))
+	}
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// DeletePasskey godoc
+// @Summary Remove a passkey
+// @Tags webauthn
+// @Param id path string true "Base64url credential ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Passkey not found"
+// @Router /me/webauthn/credentials/{id} [delete]
+func (h *WebAuthnHandler) DeletePasskey(c *gin.Context) {
+	user, ok := currentUser(c, h.Repo)
+	if !ok {
+		return
+	}
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	removed, err := h.Repo.RemovePasskey(c, user.ID, credentialID)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to remove passkey")
+		return
+	}
+	if !removed {
+		respondWithError(c, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
+
+// BeginLogin godoc
+// @Summary Start a passkey login
+// @Description Returns PublicKeyCredentialRequestOptions for navigator.credentials.get() and the challenge ID to finish with. No username is needed.
+// @Tags webauthn
+// @Produce json
+// @Success 200 {object} map[string]interface{} "challengeId and options"
+// @Failure 500 {object} map[string]interface{} "Internal Server Error"
+// @Router /login/webauthn/begin [post]
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	options, challengeID, err := h.WebAuthn.BeginLogin(c)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to start passkey login")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challengeId": challengeID, "options": options})
+}
+
+// FinishLogin godoc
+// @Summary Finish a passkey login
+// @Description Verifies the authenticator assertion and issues the same tokens as /login.
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body models.WebAuthnLoginRequest true "Challenge ID and PublicKeyCredential"
+// @Success 200 {object} map[string]interface{} "Tokens"
+// @Failure 400 {object} map[string]interface{} "Bad request when the JSON data is invalid"
+// @Failure 401 {object} map[string]interface{} "Invalid challenge or assertion"
+// @Router /login/webauthn/finish [post]
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var request models.WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid login data")
+		return
+	}
+
+	user, err := h.WebAuthn.FinishLogin(c, request.ChallengeID, bytes.NewReader(request.Credential))
+	if errors.Is(err, service.ErrWebAuthnChallengeNotFound) || errors.Is(err, service.ErrWebAuthnFailed) {
+		respondWithError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to verify passkey")
+		return
+	}
+
+	tokens, err := h.Tokens.Issue(c, user.ID.Hex(), sessionInfo(c, request.DeviceName))
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	respondWithTokens(c, http.StatusOK, "Login successful", tokens)
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// RequireScope only lets personal access tokens through when they were
+// granted scope. Session tokens carry the user's full rights and pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authMethod") != AuthMethodAccessToken {
+			c.Next()
+			return
+		}
+
+		for _, granted := range c.GetStringSlice("scopes") {
+			if granted == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token lacks required scope: " + scope})
+		c.Abort()
+	}
+}
+
+// RequireSession rejects personal access tokens on routes that manage the
+// account itself, such as sessions, passwords or other tokens.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authMethod") != AuthMethodSession {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action requires an interactive login"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
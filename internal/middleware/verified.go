@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"pwa/internal/repository"
+	"strings"
+)
+
+// Features that deployments can restrict to users with a verified email by
+// listing them, comma separated, in VERIFIED_ONLY_FEATURES.
+const (
+	FeatureCreateChannel  = "channels.create"
+	FeatureJoinChannel    = "channels.join"
+	FeatureCreateTodoList = "todolists.create"
+	FeaturePushSubscribe  = "push.subscribe"
+)
+
+func verificationRequired(feature string) bool {
+	for _, f := range strings.Split(os.Getenv("VERIFIED_ONLY_FEATURES"), ",") {
+		if strings.TrimSpace(f) == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireVerifiedEmail rejects callers without a verified email when the
+// feature is listed in VERIFIED_ONLY_FEATURES, and is a no-op otherwise. It
+// must run after JWTAuthMiddleware.
+func RequireVerifiedEmail(users *repository.UserRepository, feature string) gin.HandlerFunc {
+	required := verificationRequired(feature)
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+
+		user, err := users.FindUserByID(c, c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if !user.Verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address must be verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeChannelsRead   = "channels:read"
+	ScopeChannelsWrite  = "channels:write"
+	ScopeChannelsAdmin  = "channels:admin"
+	ScopeTodoListsRead  = "todolists:read"
+	ScopeTodoListsWrite = "todolists:write"
+)
+
+var AccessTokenScopes = []string{
+	ScopeChannelsRead,
+	ScopeChannelsWrite,
+	ScopeChannelsAdmin,
+	ScopeTodoListsRead,
+	ScopeTodoListsWrite,
+}
+
+// PersonalAccessToken lets scripts call the API on a user's behalf. Only the
+// SHA-256 hash of the token is stored; Prefix helps users recognise it.
+type PersonalAccessToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	TokenHash  string             `bson:"tokenHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
@@ -5,11 +5,228 @@ import (
 	"time"
 )
 
+// Channel is a group of users sharing todo lists. Members lists the hex IDs
+// of every member in the order they joined; Memberships holds their roles.
+// Members without a membership entry joined before roles existed and count
+// as ChannelRoleMember. Channels from before roles existed get their
+// earliest member, normally the creator, as owner when they are loaded.
 type Channel struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name      string             `bson:"name" json:"name"`
-	Members   []string           `bson:"members" json:"members"`
-	Password  string             `bson:"password,omitempty"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string             `bson:"name" json:"name"`
+	Members     []string           `bson:"members" json:"members"`
+	Memberships []ChannelMember    `bson:"memberships,omitempty" json:"memberships,omitempty"`
+	Password    string             `bson:"password,omitempty" json:"-"`
+	Bans        []ChannelBan       `bson:"bans,omitempty" json:"-"`
+	EmptySince  *time.Time         `bson:"emptySince,omitempty" json:"-"`
+	ArchivedAt  *time.Time         `bson:"archivedAt,omitempty" json:"archivedAt,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// What happens to a channel once its last member has left, set with
+// CHANNEL_EMPTY_POLICY. Archived channels are kept but can no longer be
+// joined; deleted ones go away with their todo lists after a retention
+// period.
+const (
+	EmptyChannelKeep    = "keep"
+	EmptyChannelArchive = "archive"
+	EmptyChannelDelete  = "delete"
+)
+
+type ChannelMember struct {
+	UserID   string    `bson:"userId" json:"userId"`
+	Role     string    `bson:"role" json:"role"`
+	JoinedAt time.Time `bson:"joinedAt" json:"joinedAt"`
+}
+
+// ChannelBan keeps a user out of the channel until ExpiresAt, or for good
+// when it is nil.
+type ChannelBan struct {
+	UserID    string     `bson:"userId" json:"userId"`
+	Reason    string     `bson:"reason,omitempty" json:"reason,omitempty"`
+	BannedBy  string     `bson:"bannedBy" json:"bannedBy"`
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+}
+
+func (b ChannelBan) Active(now time.Time) bool {
+	return b.ExpiresAt == nil || b.ExpiresAt.After(now)
+}
+
+// Channel roles, from most to least privileged.
+const (
+	ChannelRoleOwner  = "owner"
+	ChannelRoleAdmin  = "admin"
+	ChannelRoleMember = "member"
+	ChannelRoleViewer = "viewer"
+)
+
+// ChannelPermission is an action a channel role may allow.
+type ChannelPermission string
+
+const (
+	PermissionViewChannel     ChannelPermission = "channel:view"
+	PermissionUpdateChannel   ChannelPermission = "channel:update"
+	PermissionDeleteChannel   ChannelPermission = "channel:delete"
+	PermissionTransferChannel ChannelPermission = "channel:transfer"
+	PermissionManageMembers   ChannelPermission = "members:manage"
+	PermissionCreateTodoLists ChannelPermission = "todolists:create"
+	PermissionEditAnyTodoList ChannelPermission = "todolists:edit_any"
+	PermissionEditTasks       ChannelPermission = "tasks:edit"
+)
+
+// channelPermissions is the permission matrix. Members may also edit and
+// delete the lists they created themselves.
+var channelPermissions = map[string][]ChannelPermission{
+	ChannelRoleOwner: {
+		PermissionViewChannel, PermissionUpdateChannel, PermissionDeleteChannel, PermissionTransferChannel, PermissionManageMembers,
+		PermissionCreateTodoLists, PermissionEditAnyTodoList, PermissionEditTasks,
+	},
+	ChannelRoleAdmin: {
+		PermissionViewChannel, PermissionUpdateChannel, PermissionManageMembers,
+		PermissionCreateTodoLists, PermissionEditAnyTodoList, PermissionEditTasks,
+	},
+	ChannelRoleMember: {PermissionViewChannel, PermissionCreateTodoLists, PermissionEditTasks},
+	ChannelRoleViewer: {PermissionViewChannel},
+}
+
+var channelRoleRanks = map[string]int{
+	ChannelRoleOwner:  4,
+	ChannelRoleAdmin:  3,
+	ChannelRoleMember: 2,
+	ChannelRoleViewer: 1,
+}
+
+// ChannelRoleAllows reports whether role grants permission.
+func ChannelRoleAllows(role string, permission ChannelPermission) bool {
+	for _, p := range channelPermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelRoleOutranks reports whether role a is more privileged than b.
+func ChannelRoleOutranks(a, b string) bool {
+	return channelRoleRanks[a] > channelRoleRanks[b]
+}
+
+// MemberRole returns the user's role in the channel, or an empty string
+// when they are not a member.
+func (c Channel) MemberRole(userID string) string {
+	for _, membership := range c.Memberships {
+		if membership.UserID == userID {
+			return membership.Role
+		}
+	}
+	for _, member := range c.Members {
+		if member == userID {
+			return ChannelRoleMember
+		}
+	}
+	return ""
+}
+
+// HasOwner reports whether a member holds the owner role.
+func (c Channel) HasOwner() bool {
+	for _, membership := range c.Memberships {
+		if membership.Role == ChannelRoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the user's role in the channel grants permission.
+func (c Channel) Allows(userID string, permission ChannelPermission) bool {
+	return ChannelRoleAllows(c.MemberRole(userID), permission)
+}
+
+// MemberList returns every member with their role, including members that
+// predate roles.
+func (c Channel) MemberList() []ChannelMember {
+	members := make([]ChannelMember, 0, len(c.Members))
+	seen := make(map[string]bool)
+	for _, membership := range c.Memberships {
+		members = append(members, membership)
+		seen[membership.UserID] = true
+	}
+	for _, member := range c.Members {
+		if !seen[member] {
+			members = append(members, ChannelMember{UserID: member, Role: ChannelRoleMember, JoinedAt: c.CreatedAt})
+		}
+	}
+	return members
+}
+
+// Successor returns who takes over when the owner leaves: the
+// longest-standing admin, or failing that the longest-standing other
+// member.
+func (c Channel) Successor(ownerID string) (ChannelMember, bool) {
+	var successor ChannelMember
+	found := false
+	for _, member := range c.MemberList() {
+		if member.UserID == ownerID {
+			continue
+		}
+		if !found ||
+			ChannelRoleOutranks(member.Role, successor.Role) ||
+			(member.Role == successor.Role && member.JoinedAt.Before(successor.JoinedAt)) {
+			successor = member
+			found = true
+		}
+	}
+	return successor, found
+}
+
+// IsBanned reports whether the user is currently banned from the channel.
+func (c Channel) IsBanned(userID string) bool {
+	now := time.Now()
+	for _, ban := range c.Bans {
+		if ban.UserID == userID && ban.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveBans returns the bans that have not expired yet.
+func (c Channel) ActiveBans() []ChannelBan {
+	now := time.Now()
+	bans := []ChannelBan{}
+	for _, ban := range c.Bans {
+		if ban.Active(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
+
+type CreateChannelRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password,omitempty"`
+}
+
+// UpdateChannelRequest lists the channel settings admins can change. Nil
+// fields are left untouched; an empty password removes it.
+type UpdateChannelRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Password *string `json:"password,omitempty"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member viewer"`
+}
+
+// BanUserRequest bans a user, who need not be a member yet. Without
+// ExpiresAt the ban is permanent.
+type BanUserRequest struct {
+	UserID    string     `json:"userId" binding:"required"`
+	Reason    string     `json:"reason,omitempty" binding:"max=500"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID string `json:"userId" binding:"required"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ChannelInvite is a link that adds whoever opens it to a channel with the
+// given role. Only the SHA-256 hash of the token is stored. A MaxUses of
+// zero means the link can be used any number of times.
+type ChannelInvite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ChannelID primitive.ObjectID `bson:"channelId" json:"channelId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	Prefix    string             `bson:"prefix" json:"prefix"`
+	Role      string             `bson:"role" json:"role"`
+	MaxUses   int                `bson:"maxUses" json:"maxUses"`
+	Uses      int                `bson:"uses" json:"uses"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// CreateChannelInviteRequest describes a new invite link. Role defaults to
+// member, MaxUses to unlimited and ExpiresAt to CHANNEL_INVITE_TTL from now.
+type CreateChannelInviteRequest struct {
+	Role      string     `json:"role,omitempty" binding:"omitempty,oneof=admin member viewer"`
+	MaxUses   int        `json:"maxUses,omitempty" binding:"omitempty,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Data export states.
+const (
+	ExportStatusPending = "pending"
+	ExportStatusRunning = "running"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+)
+
+// DataExport tracks a personal data archive requested by a user. The zip is
+// stored in GridFS under FileID once Status is ready.
+type DataExport struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      primitive.ObjectID  `bson:"userId" json:"userId"`
+	Status      string              `bson:"status" json:"status"`
+	FileID      *primitive.ObjectID `bson:"fileId,omitempty" json:"-"`
+	Size        int64               `bson:"size,omitempty" json:"size,omitempty"`
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+	CompletedAt *time.Time          `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time          `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Registration modes, set with REGISTRATION_MODE.
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationClosed     = "closed"
+)
+
+// InviteCode lets someone register while registration is invite-only. Only
+// the SHA-256 hash of the code is stored. Email, when set, is the only
+// address that can redeem it; ChannelIDs are joined on registration.
+type InviteCode struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	CodeHash   string               `bson:"codeHash" json:"-"`
+	Prefix     string               `bson:"prefix" json:"prefix"`
+	Email      string               `bson:"email,omitempty" json:"email,omitempty"`
+	MaxUses    int                  `bson:"maxUses" json:"maxUses"`
+	Uses       int                  `bson:"uses" json:"uses"`
+	ChannelIDs []primitive.ObjectID `bson:"channelIds,omitempty" json:"channelIds,omitempty"`
+	CreatedBy  primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	ExpiresAt  *time.Time           `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time           `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt  time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// CreateInviteCodeRequest describes a new invite code. MaxUses defaults to
+// one.
+type CreateInviteCodeRequest struct {
+	MaxUses    int        `json:"maxUses,omitempty" binding:"omitempty,min=1"`
+	Email      string     `json:"email,omitempty" binding:"omitempty,email"`
+	ChannelIDs []string   `json:"channelIds,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// RegisterRequest is the body of POST /users. InviteCode is required while
+// registration is invite-only.
+type RegisterRequest struct {
+	Username   string `json:"username" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	InviteCode string `json:"inviteCode,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Join request statuses. Requests are kept after they are decided, and
+// pending requests of deleted accounts are cancelled.
+const (
+	JoinRequestPending   = "pending"
+	JoinRequestApproved  = "approved"
+	JoinRequestDenied    = "denied"
+	JoinRequestCancelled = "cancelled"
+)
+
+// JoinRequest asks the channel's owner and admins to let a user in.
+type JoinRequest struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	ChannelID primitive.ObjectID  `bson:"channelId" json:"channelId"`
+	UserID    primitive.ObjectID  `bson:"userId" json:"userId"`
+	Message   string              `bson:"message,omitempty" json:"message,omitempty"`
+	Status    string              `bson:"status" json:"status"`
+	DecidedBy *primitive.ObjectID `bson:"decidedBy,omitempty" json:"decidedBy,omitempty"`
+	DecidedAt *time.Time          `bson:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// JoinChannelRequest is the body of POST /channels/:id/join. With the
+// channel password the user joins right away; without one a join request is
+// filed for the channel admins.
+type JoinChannelRequest struct {
+	Password string `json:"password,omitempty"`
+	Message  string `json:"message,omitempty" binding:"max=500"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// LoginThrottle counts recent failed logins for one key, either a user
+// ("user:<id>"), an unknown identifier ("identifier:<name>") or a client IP
+// ("ip:<address>"). For accounts, IPs lists the clients the failures came
+// from and UnlockID is the ID of the unlock link mailed for the current
+// lockout, which can be used once.
+type LoginThrottle struct {
+	Key           string     `bson:"_id" json:"key"`
+	Failures      int        `bson:"failures" json:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt" json:"lastFailureAt"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	IPs           []string   `bson:"ips,omitempty" json:"-"`
+	UnlockID      string     `bson:"unlockId,omitempty" json:"-"`
+}
+
+// Login methods recorded on LoginEvent.
+const (
+	LoginMethodPassword = "password"
+	LoginMethodMFA      = "mfa"
+	LoginMethodOIDC     = "oidc"
+)
+
+type LoginEvent struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     *primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	Identifier string              `bson:"identifier,omitempty" json:"identifier,omitempty"`
+	Method     string              `bson:"method" json:"method"`
+	Success    bool                `bson:"success" json:"success"`
+	Reason     string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	IP         string              `bson:"ip" json:"ip"`
+	UserAgent  string              `bson:"userAgent" json:"userAgent"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider.
+type ExternalIdentity struct {
+	Issuer   string    `bson:"issuer" json:"issuer"`
+	Subject  string    `bson:"subject" json:"subject"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// OIDCLoginState carries the state, nonce and PKCE verifier of an
+// authorization request until the provider redirects back.
+type OIDCLoginState struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	State        string             `bson:"state"`
+	Nonce        string             `bson:"nonce"`
+	CodeVerifier string             `bson:"codeVerifier"`
+	ExpiresAt    time.Time          `bson:"expiresAt"`
+}
+
+type OIDCCallbackRequest struct {
+	Code       string `json:"code" binding:"required"`
+	State      string `json:"state" binding:"required"`
+	DeviceName string `json:"deviceName,omitempty"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Profile is the authenticated user's own profile.
+type Profile struct {
+	ID          primitive.ObjectID `json:"id"`
+	Username    string             `json:"username"`
+	Email       string             `json:"email"`
+	DisplayName string             `json:"displayName,omitempty"`
+	AvatarURL   string             `json:"avatarUrl,omitempty"`
+	Timezone    string             `json:"timezone,omitempty"`
+	Locale      string             `json:"locale,omitempty"`
+}
+
+// PublicProfile is what other users may see of an account, e.g. to label
+// channel members or task authors. It never carries the email or the
+// password hash.
+type PublicProfile struct {
+	ID          primitive.ObjectID `json:"id"`
+	Username    string             `json:"username"`
+	DisplayName string             `json:"displayName,omitempty"`
+	AvatarURL   string             `json:"avatarUrl,omitempty"`
+}
+
+// UpdateProfileRequest lists the profile fields a user can change. Nil
+// fields are left untouched and empty strings clear the field.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"displayName,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+}
+
+// AvatarURL is the path the user's avatar is served from, or empty when
+// they have none. The version parameter changes with every upload so the
+// image can be cached indefinitely.
+func (u User) AvatarURL() string {
+	if u.AvatarID == nil {
+		return ""
+	}
+	return "/users/" + u.ID.Hex() + "/avatar?v=" + u.AvatarID.Hex()
+}
+
+func (u User) Profile() Profile {
+	return Profile{
+		ID:          u.ID,
+		Username:    u.Username,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		AvatarURL:   u.AvatarURL(),
+		Timezone:    u.Timezone,
+		Locale:      u.Locale,
+	}
+}
+
+func (u User) PublicProfile() PublicProfile {
+	return PublicProfile{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		AvatarURL:   u.AvatarURL(),
+	}
+}
+
+// DirectoryPage is one page of the user directory. NextCursor is empty on
+// the last page.
+type DirectoryPage struct {
+	Users      []PublicProfile `json:"users"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Session is a single logged-in device. Its hex ID is embedded as the jti
+// of every token issued for it. Impersonation sessions are opened by the
+// admin in ActorID on behalf of UserID and end at ExpiresAt.
+type Session struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     primitive.ObjectID  `bson:"userId" json:"userId"`
+	ActorID    *primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	Reason     string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	DeviceName string              `bson:"deviceName,omitempty" json:"deviceName,omitempty"`
+	UserAgent  string              `bson:"userAgent" json:"userAgent"`
+	IP         string              `bson:"ip" json:"ip"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time           `bson:"lastSeenAt" json:"lastSeenAt"`
+	ExpiresAt  *time.Time          `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	Current    bool                `bson:"-" json:"current"`
+}
+
+// SessionInfo describes the client a session is created or refreshed from.
+type SessionInfo struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
+
+// AuditLogEntry records one request made while impersonating a user.
+type AuditLogEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ActorID   primitive.ObjectID `bson:"actorId" json:"actorId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	SessionID primitive.ObjectID `bson:"sessionId" json:"sessionId"`
+	Method    string             `bson:"method" json:"method"`
+	Path      string             `bson:"path" json:"path"`
+	Status    int                `bson:"status" json:"status"`
+	IP        string             `bson:"ip" json:"ip"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
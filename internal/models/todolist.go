@@ -25,3 +25,20 @@ type TodoList struct {
 	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
+
+// FindTask returns the task with the given ID, if the list has one.
+func (l TodoList) FindTask(id string) (Task, bool) {
+	for _, task := range l.Tasks {
+		if task.ID.Hex() == id {
+			return task, true
+		}
+	}
+	return Task{}, false
+}
+
+// UpdateTodoListRequest lists the fields that can be changed on a todo list.
+// Nil fields are left untouched.
+type UpdateTodoListRequest struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
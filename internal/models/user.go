@@ -6,15 +6,101 @@ import (
 )
 
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Username  string             `bson:"username" json:"username"`
-	Email     string             `bson:"email" json:"email"`
-	Password  string             `bson:"password" json:"password"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID                  primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Username            string               `bson:"username" json:"username"`
+	Email               string               `bson:"email" json:"email"`
+	Password            string               `bson:"password" json:"password,omitempty"`
+	Role                string               `bson:"role,omitempty" json:"role,omitempty"`
+	DisplayName         string               `bson:"displayName,omitempty" json:"displayName,omitempty"`
+	AvatarID            *primitive.ObjectID  `bson:"avatarId,omitempty" json:"-"`
+	Timezone            string               `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Locale              string               `bson:"locale,omitempty" json:"locale,omitempty"`
+	Verified            bool                 `bson:"verified" json:"verified"`
+	VerifiedAt          *time.Time           `bson:"verifiedAt,omitempty" json:"verifiedAt,omitempty"`
+	MFA                 *MFASettings         `bson:"mfa,omitempty" json:"-"`
+	Passkeys            []WebAuthnCredential `bson:"webauthnCredentials,omitempty" json:"-"`
+	Identities          []ExternalIdentity   `bson:"identities,omitempty" json:"-"`
+	DeletionScheduledAt *time.Time           `bson:"deletionScheduledAt,omitempty" json:"deletionScheduledAt,omitempty"`
+	CreatedAt           time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt           time.Time            `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Global roles. Accounts created before roles existed have no role stored
+// and are treated as RoleUser.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// MFASettings holds the user's TOTP enrollment. RecoveryCodes are SHA-256
+// hashes of single-use codes; LastUsedStep prevents replaying a TOTP code.
+type MFASettings struct {
+	Enabled           bool       `bson:"enabled"`
+	TOTPSecret        string     `bson:"totpSecret,omitempty"`
+	PendingTOTPSecret string     `bson:"pendingTotpSecret,omitempty"`
+	RecoveryCodes     []string   `bson:"recoveryCodes,omitempty"`
+	LastUsedStep      int64      `bson:"lastUsedStep,omitempty"`
+	EnabledAt         *time.Time `bson:"enabledAt,omitempty"`
+}
+
+func (u User) MFAEnabled() bool {
+	return u.MFA != nil && u.MFA.Enabled
+}
+
+// GlobalRole returns the user's role, defaulting to RoleUser.
+func (u User) GlobalRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
 }
 
 type LoginRequest struct {
 	Identifier string `json:"identifier"`
 	Password   string `json:"password"`
+	DeviceName string `json:"deviceName,omitempty"`
+}
+
+type MFALoginRequest struct {
+	MFAToken   string `json:"mfaToken" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"deviceName,omitempty"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// UpdateUserRequest lists the account fields a user can change. Nil fields
+// are left untouched. CurrentPassword is required to change the email or
+// password of your own account.
+type UpdateUserRequest struct {
+	Username        *string `json:"username,omitempty"`
+	Email           *string `json:"email,omitempty" binding:"omitempty,email"`
+	Password        *string `json:"password,omitempty"`
+	CurrentPassword string  `json:"currentPassword,omitempty"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin user"`
+}
+
+// AdminBootstrap marks that the first admin was promoted through
+// /admin/bootstrap. Only one such document can exist.
+type AdminBootstrap struct {
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+type BootstrapAdminRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ScheduleDeletionRequest struct {
+	Password string `json:"password"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// WebAuthnCredential is a passkey registered to a user.
+type WebAuthnCredential struct {
+	ID              []byte     `bson:"id" json:"-"`
+	Name            string     `bson:"name" json:"name"`
+	PublicKey       []byte     `bson:"publicKey" json:"-"`
+	AttestationType string     `bson:"attestationType" json:"-"`
+	Transports      []string   `bson:"transports,omitempty" json:"transports,omitempty"`
+	AAGUID          []byte     `bson:"aaguid,omitempty" json:"-"`
+	SignCount       uint32     `bson:"signCount" json:"-"`
+	UserVerified    bool       `bson:"userVerified" json:"-"`
+	BackupEligible  bool       `bson:"backupEligible" json:"backupEligible"`
+	BackupState     bool       `bson:"backupState" json:"backupState"`
+	CloneWarning    bool       `bson:"cloneWarning" json:"cloneWarning"`
+	CreatedAt       time.Time  `bson:"createdAt" json:"createdAt"`
+	LastUsedAt      *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnChallenge keeps the server side state of a registration or login
+// ceremony between its begin and finish requests.
+type WebAuthnChallenge struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty"`
+	Ceremony  string               `bson:"ceremony"`
+	UserID    *primitive.ObjectID  `bson:"userId,omitempty"`
+	Session   webauthn.SessionData `bson:"session"`
+	ExpiresAt time.Time            `bson:"expiresAt"`
+}
+
+type WebAuthnRegistrationRequest struct {
+	ChallengeID string          `json:"challengeId" binding:"required"`
+	Name        string          `json:"name"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnLoginRequest struct {
+	ChallengeID string          `json:"challengeId" binding:"required"`
+	DeviceName  string          `json:"deviceName,omitempty"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+// accessTokenTouchInterval limits how often LastUsedAt is written.
+const accessTokenTouchInterval = time.Minute
+
+type AccessTokenRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *AccessTokenRepository) CreateAccessToken(ctx context.Context, token models.PersonalAccessToken) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, token)
+}
+
+// FindActiveByHash returns the token unless it is revoked or expired.
+func (r *AccessTokenRepository) FindActiveByHash(ctx context.Context, tokenHash string) (models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"revokedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$exists": false}},
+			{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+	err := r.Collection.FindOne(ctx, filter).Decode(&token)
+	return token, err
+}
+
+func (r *AccessTokenRepository) FindActiveByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *AccessTokenRepository) Touch(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.M{"_id": id, "$or": []bson.M{
+		{"lastUsedAt": bson.M{"$exists": false}},
+		{"lastUsedAt": bson.M{"$lt": now.Add(-accessTokenTouchInterval)}},
+	}}
+	_, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lastUsedAt": now}})
+	return err
+}
+
+// RevokeAccessToken revokes one of the user's tokens and reports whether an
+// active token matched.
+func (r *AccessTokenRepository) RevokeAccessToken(ctx context.Context, id, userID primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "userId": userID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeUserTokens revokes every active token of the user.
+func (r *AccessTokenRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	_, err := r.Collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	return err
+}
+
+func (r *AccessTokenRepository) DeleteUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
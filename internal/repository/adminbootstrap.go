@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"time"
+)
+
+// adminBootstrapID is the _id of the single marker document, so the
+// collection's built-in unique index lets only one bootstrap succeed.
+const adminBootstrapID = "admin"
+
+type AdminBootstrapRepository struct {
+	Collection *mongo.Collection
+}
+
+// Claim records userID as the bootstrapped admin and reports whether no
+// bootstrap had happened before. Of concurrent callers exactly one wins.
+func (r *AdminBootstrapRepository) Claim(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	marker := models.AdminBootstrap{ID: adminBootstrapID, UserID: userID, CreatedAt: time.Now()}
+	_, err := r.Collection.InsertOne(ctx, marker)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release undoes a Claim whose promotion failed, so bootstrapping can be
+// retried.
+func (r *AdminBootstrapRepository) Release(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteOne(ctx, bson.M{"_id": adminBootstrapID, "userId": userID})
+	return err
+}
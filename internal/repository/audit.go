@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+)
+
+type AuditLogRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *AuditLogRepository) CreateEntry(ctx context.Context, entry models.AuditLogEntry) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, entry)
+}
+
+// FindBySession returns the requests made in one impersonation session of
+// the user, oldest first.
+func (r *AuditLogRepository) FindBySession(ctx context.Context, userID, sessionID primitive.ObjectID) ([]models.AuditLogEntry, error) {
+	var entries []models.AuditLogEntry
+	filter := bson.M{"userId": userID, "sessionId": sessionID}
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
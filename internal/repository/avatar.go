@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+)
+
+// AvatarRepository stores processed avatar images in a GridFS bucket. Each
+// file carries the owner's ID in its metadata.
+type AvatarRepository struct {
+	Files *gridfs.Bucket
+}
+
+func (r *AvatarRepository) UploadAvatar(userID primitive.ObjectID, contentType string, source io.Reader) (primitive.ObjectID, error) {
+	opts := options.GridFSUpload().SetMetadata(bson.M{"userId": userID, "contentType": contentType})
+	return r.Files.UploadFromStream(userID.Hex(), source, opts)
+}
+
+func (r *AvatarRepository) OpenAvatar(fileID primitive.ObjectID) (*gridfs.DownloadStream, error) {
+	return r.Files.OpenDownloadStream(fileID)
+}
+
+func (r *AvatarRepository) DeleteAvatar(ctx context.Context, fileID primitive.ObjectID) error {
+	if err := r.Files.DeleteContext(ctx, fileID); err != nil && err != gridfs.ErrFileNotFound {
+		return err
+	}
+	return nil
+}
+
+// DeleteUserAvatars removes every avatar the user ever uploaded.
+func (r *AvatarRepository) DeleteUserAvatars(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := r.Files.FindContext(ctx, bson.M{"metadata.userId": userID})
+	if err != nil {
+		return err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	var files []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := r.DeleteAvatar(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,21 +7,29 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
 	"pwa/internal/models"
+	"pwa/pkg/passwordhash"
+	"time"
 )
 
+// ErrChannelNotJoined is returned by JoinChannel when the user could not be
+// added: they are already a member or banned, or the channel is archived or
+// gone.
+var ErrChannelNotJoined = errors.New("channel not joined")
+
 type ChannelRepository struct {
 	Collection *mongo.Collection
 }
 
 func (r *ChannelRepository) CreateChannel(ctx context.Context, channel models.Channel) (*mongo.InsertOneResult, error) {
 	if channel.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(channel.Password), bcrypt.DefaultCost)
+		hashedPassword, err := passwordhash.Hash(channel.Password)
 		if err != nil {
 			return nil, err
 		}
-		channel.Password = string(hashedPassword)
+		channel.Password = hashedPassword
 	}
 
 	return r.Collection.InsertOne(ctx, channel)
@@ -66,13 +74,62 @@ func (r *ChannelRepository) FindChannelByID(ctx context.Context, id string) (mod
 		}
 		return channel, err
 	}
+	if len(channel.Members) > 0 && !channel.HasOwner() {
+		return r.assignLegacyOwner(ctx, channel)
+	}
 	return channel, nil
 }
 
-func (r *ChannelRepository) UpdateChannel(ctx context.Context, id string, channel models.Channel) (*mongo.UpdateResult, error) {
+// assignLegacyOwner makes the earliest member of a channel created before
+// roles existed its owner and returns the updated channel.
+func (r *ChannelRepository) assignLegacyOwner(ctx context.Context, channel models.Channel) (models.Channel, error) {
+	first := bson.M{"$arrayElemAt": bson.A{"$members", 0}}
+	owner := bson.M{"userId": first, "role": models.ChannelRoleOwner, "joinedAt": "$createdAt"}
+	others := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$memberships", bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this.userId", first}},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"memberships": bson.M{"$concatArrays": bson.A{bson.A{owner}, others}}}}},
+	}
+
+	// The filter keeps concurrent loads from both assigning an owner.
+	filter := bson.M{"_id": channel.ID, "members.0": bson.M{"$exists": true}, "memberships.role": bson.M{"$ne": models.ChannelRoleOwner}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.Channel
+	err := r.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = r.Collection.FindOne(ctx, bson.M{"_id": channel.ID}).Decode(&updated)
+	}
+	if err != nil {
+		return channel, err
+	}
+	return updated, nil
+}
+
+// UpdateChannel applies the given settings. A new password is hashed
+// first, and an empty one removes the password.
+func (r *ChannelRepository) UpdateChannel(ctx context.Context, id string, request models.UpdateChannelRequest) (*mongo.UpdateResult, error) {
+	set := bson.M{"updatedAt": time.Now()}
+	update := bson.M{}
+	if request.Name != nil {
+		set["name"] = *request.Name
+	}
+	if request.Password != nil {
+		if *request.Password == "" {
+			update["$unset"] = bson.M{"password": ""}
+		} else {
+			hashedPassword, err := passwordhash.Hash(*request.Password)
+			if err != nil {
+				return nil, err
+			}
+			set["password"] = hashedPassword
+		}
+	}
+	update["$set"] = set
+
 	objID, _ := primitive.ObjectIDFromHex(id)
 	filter := bson.M{"_id": objID}
-	update := bson.M{"$set": channel}
 	return r.Collection.UpdateOne(ctx, filter, update)
 }
 
@@ -95,6 +152,8 @@ func (r *ChannelRepository) GetChannelMembers(ctx context.Context, channelID str
 	return channel.Members, nil
 }
 
+// CheckChannelPassword reports whether password opens the channel. A
+// matching hash in an outdated format is replaced on the way.
 func (r *ChannelRepository) CheckChannelPassword(ctx context.Context, channelID, password string) (bool, error) {
 	cid, err := primitive.ObjectIDFromHex(channelID)
 	if err != nil {
@@ -107,18 +166,57 @@ func (r *ChannelRepository) CheckChannelPassword(ctx context.Context, channelID,
 		return false, err
 	}
 
-	return bcrypt.CompareHashAndPassword([]byte(channel.Password), []byte(password)) == nil, nil
+	ok, rehash, err := passwordhash.Verify(password, channel.Password)
+	if !ok {
+		if err != nil && !errors.Is(err, passwordhash.ErrUnknownFormat) {
+			return false, err
+		}
+		return false, nil
+	}
+	if rehash {
+		if hashedPassword, err := passwordhash.Hash(password); err == nil {
+			filter := bson.M{"_id": cid, "password": channel.Password}
+			if _, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"password": hashedPassword}}); err != nil {
+				log.Printf("Failed to store rehashed password of channel %s: %v", channelID, err)
+			}
+		}
+	}
+	return true, nil
 }
 
-func (r *ChannelRepository) JoinChannel(ctx context.Context, channelID, userID string) error {
+// JoinChannel adds the user to the channel with the given role. Users who
+// are already members keep their current role, and banned users and
+// archived channels are left out; ErrChannelNotJoined reports either case.
+func (r *ChannelRepository) JoinChannel(ctx context.Context, channelID, userID, role string) error {
 	cid, err := primitive.ObjectIDFromHex(channelID)
 	if err != nil {
 		return err
 	}
-	filter := bson.M{"_id": cid}
-	update := bson.M{"$addToSet": bson.M{"members": userID}}
-	_, err = r.Collection.UpdateOne(ctx, filter, update)
-	return err
+	activeBan := bson.M{
+		"userId": userID,
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$exists": false}},
+			{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+	filter := bson.M{
+		"_id":        cid,
+		"members":    bson.M{"$ne": userID},
+		"bans":       bson.M{"$not": bson.M{"$elemMatch": activeBan}},
+		"archivedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$push":  bson.M{"members": userID, "memberships": models.ChannelMember{UserID: userID, Role: role, JoinedAt: time.Now()}},
+		"$unset": bson.M{"emptySince": ""},
+	}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrChannelNotJoined
+	}
+	return nil
 }
 
 func (r *ChannelRepository) LeaveChannel(ctx context.Context, channelID, userID string) error {
@@ -127,7 +225,179 @@ func (r *ChannelRepository) LeaveChannel(ctx context.Context, channelID, userID
 		return err
 	}
 	filter := bson.M{"_id": cid}
-	update := bson.M{"$pull": bson.M{"members": userID}}
+	update := bson.M{"$pull": bson.M{"members": userID, "memberships": bson.M{"userId": userID}}}
 	_, err = r.Collection.UpdateOne(ctx, filter, update)
 	return err
 }
+
+// SetMemberRole changes a member's role and reports whether the user is a
+// member. Members from before roles existed get a membership entry.
+func (r *ChannelRepository) SetMemberRole(ctx context.Context, channelID, userID, role string) (bool, error) {
+	cid, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.M{"_id": cid, "memberships.userId": userID}
+	update := bson.M{"$set": bson.M{"memberships.$.role": role, "updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 1 {
+		return true, nil
+	}
+
+	var channel models.Channel
+	if err := r.Collection.FindOne(ctx, bson.M{"_id": cid, "members": userID}).Decode(&channel); errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	filter = bson.M{"_id": cid, "members": userID, "memberships.userId": bson.M{"$ne": userID}}
+	update = bson.M{
+		"$push": bson.M{"memberships": models.ChannelMember{UserID: userID, Role: role, JoinedAt: channel.CreatedAt}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	result, err = r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// TransferOwnership makes to the owner of the channel and from, who must be
+// its owner, an admin. It reports whether from was the owner and to a
+// member with a membership entry.
+func (r *ChannelRepository) TransferOwnership(ctx context.Context, channelID, from, to string) (bool, error) {
+	cid, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.M{
+		"_id":                cid,
+		"memberships":        bson.M{"$elemMatch": bson.M{"userId": from, "role": models.ChannelRoleOwner}},
+		"memberships.userId": to,
+	}
+	update := bson.M{"$set": bson.M{
+		"memberships.$[from].role": models.ChannelRoleAdmin,
+		"memberships.$[to].role":   models.ChannelRoleOwner,
+		"updatedAt":                time.Now(),
+	}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"from.userId": from},
+		bson.M{"to.userId": to},
+	}})
+	result, err := r.Collection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// MarkEmptyChannels stamps channels without members with the time they
+// were found empty, archiving them too when archive is set.
+func (r *ChannelRepository) MarkEmptyChannels(ctx context.Context, archive bool) error {
+	filter := bson.M{"members": bson.M{"$size": 0}, "emptySince": bson.M{"$exists": false}}
+	_, err := r.Collection.UpdateMany(ctx, filter, markEmpty(archive))
+	return err
+}
+
+// MarkEmptyChannel does what MarkEmptyChannels does for one channel.
+func (r *ChannelRepository) MarkEmptyChannel(ctx context.Context, id primitive.ObjectID, archive bool) error {
+	filter := bson.M{"_id": id, "members": bson.M{"$size": 0}, "emptySince": bson.M{"$exists": false}}
+	_, err := r.Collection.UpdateOne(ctx, filter, markEmpty(archive))
+	return err
+}
+
+func markEmpty(archive bool) bson.M {
+	now := time.Now()
+	set := bson.M{"emptySince": now}
+	if archive {
+		set["archivedAt"] = now
+	}
+	return bson.M{"$set": set}
+}
+
+// FindChannelsEmptySince returns channels that have had no members since
+// before the given time.
+func (r *ChannelRepository) FindChannelsEmptySince(ctx context.Context, before time.Time) ([]models.Channel, error) {
+	var channels []models.Channel
+	filter := bson.M{"members": bson.M{"$size": 0}, "emptySince": bson.M{"$lt": before}}
+	cursor, err := r.Collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// DeleteEmptyChannel deletes the channel unless someone joined it in the
+// meantime, and reports whether it was deleted.
+func (r *ChannelRepository) DeleteEmptyChannel(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := r.Collection.DeleteOne(ctx, bson.M{"_id": id, "members": bson.M{"$size": 0}})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// BanUser removes the user from the channel and records the ban, replacing
+// any earlier ban of the same user.
+func (r *ChannelRepository) BanUser(ctx context.Context, channelID string, ban models.ChannelBan) error {
+	cid, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return err
+	}
+	without := func(field string) bson.M {
+		return bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{field, bson.A{}}},
+			"cond":  bson.M{"$ne": bson.A{"$$this.userId", ban.UserID}},
+		}}
+	}
+	// One pipeline update, so the user is never out without being banned.
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"members": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$members", bson.A{}}},
+				"cond":  bson.M{"$ne": bson.A{"$$this", ban.UserID}},
+			}},
+			"memberships": without("$memberships"),
+			"bans":        bson.M{"$concatArrays": bson.A{without("$bans"), bson.A{bson.M{"$literal": ban}}}},
+			"updatedAt":   time.Now(),
+		}}},
+	}
+	_, err = r.Collection.UpdateOne(ctx, bson.M{"_id": cid}, update)
+	return err
+}
+
+// UnbanUser lifts the user's ban and reports whether there was one.
+func (r *ChannelRepository) UnbanUser(ctx context.Context, channelID, userID string) (bool, error) {
+	cid, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.M{"_id": cid, "bans.userId": userID}
+	update := bson.M{"$pull": bson.M{"bans": bson.M{"userId": userID}}, "$set": bson.M{"updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RemoveMemberFromAll removes the user from every channel they belong to.
+func (r *ChannelRepository) RemoveMemberFromAll(ctx context.Context, userID string) error {
+	filter := bson.M{"members": userID}
+	update := bson.M{"$pull": bson.M{"members": userID, "memberships": bson.M{"userId": userID}}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
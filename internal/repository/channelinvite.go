@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+type ChannelInviteRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *ChannelInviteRepository) CreateChannelInvite(ctx context.Context, invite models.ChannelInvite) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, invite)
+}
+
+func (r *ChannelInviteRepository) FindChannelInvites(ctx context.Context, channelID primitive.ObjectID) ([]models.ChannelInvite, error) {
+	var invites []models.ChannelInvite
+	cursor, err := r.Collection.Find(ctx, bson.M{"channelId": channelID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// UseChannelInvite counts one use of the link if it is still valid and
+// returns it. mongo.ErrNoDocuments means the token is unknown, revoked,
+// expired or used up.
+func (r *ChannelInviteRepository) UseChannelInvite(ctx context.Context, tokenHash string) (models.ChannelInvite, error) {
+	var invite models.ChannelInvite
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+		"$or": []bson.M{
+			{"maxUses": 0},
+			{"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}},
+		},
+	}
+	update := bson.M{"$inc": bson.M{"uses": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	return invite, err
+}
+
+// ReleaseChannelInvite gives back a use taken by UseChannelInvite, e.g.
+// when the user turned out to be a member already.
+func (r *ChannelInviteRepository) ReleaseChannelInvite(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "uses": bson.M{"$gt": 0}}
+	_, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": -1}})
+	return err
+}
+
+// RevokeChannelInvite reports whether an unrevoked link of the channel
+// matched.
+func (r *ChannelInviteRepository) RevokeChannelInvite(ctx context.Context, channelID, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "channelId": channelID, "revokedAt": bson.M{"$exists": false}}
+	result, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"io"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+// DataExportRepository stores export records in Collection and the archives
+// themselves in the Files GridFS bucket.
+type DataExportRepository struct {
+	Collection *mongo.Collection
+	Files      *gridfs.Bucket
+}
+
+func (r *DataExportRepository) CreateExport(ctx context.Context, export models.DataExport) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, export)
+}
+
+func (r *DataExportRepository) FindExport(ctx context.Context, id, userID primitive.ObjectID) (models.DataExport, error) {
+	var export models.DataExport
+	err := r.Collection.FindOne(ctx, bson.M{"_id": id, "userId": userID}).Decode(&export)
+	return export, err
+}
+
+// FindUnfinishedExport returns the user's pending or running export, if any.
+func (r *DataExportRepository) FindUnfinishedExport(ctx context.Context, userID primitive.ObjectID) (models.DataExport, error) {
+	var export models.DataExport
+	filter := bson.M{"userId": userID, "status": bson.M{"$in": bson.A{models.ExportStatusPending, models.ExportStatusRunning}}}
+	err := r.Collection.FindOne(ctx, filter).Decode(&export)
+	return export, err
+}
+
+func (r *DataExportRepository) SetStatus(ctx context.Context, id primitive.ObjectID, status, message string) error {
+	set := bson.M{"status": status}
+	if message != "" {
+		set["error"] = message
+	}
+	if status == models.ExportStatusFailed {
+		set["completedAt"] = time.Now()
+	}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *DataExportRepository) MarkReady(ctx context.Context, id, fileID primitive.ObjectID, size int64, expiresAt time.Time) error {
+	update := bson.M{"$set": bson.M{
+		"status":      models.ExportStatusReady,
+		"fileId":      fileID,
+		"size":        size,
+		"completedAt": time.Now(),
+		"expiresAt":   expiresAt,
+	}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// FailStaleExports marks exports that have been unfinished since before the
+// given time as failed, e.g. after the instance building them stopped.
+func (r *DataExportRepository) FailStaleExports(ctx context.Context, before time.Time) error {
+	filter := bson.M{
+		"status":    bson.M{"$in": bson.A{models.ExportStatusPending, models.ExportStatusRunning}},
+		"createdAt": bson.M{"$lt": before},
+	}
+	update := bson.M{"$set": bson.M{"status": models.ExportStatusFailed, "error": "export was interrupted", "completedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *DataExportRepository) UploadArchive(filename string, source io.Reader) (primitive.ObjectID, error) {
+	return r.Files.UploadFromStream(filename, source)
+}
+
+func (r *DataExportRepository) OpenArchive(fileID primitive.ObjectID) (*gridfs.DownloadStream, error) {
+	return r.Files.OpenDownloadStream(fileID)
+}
+
+// DeleteExpiredExports removes exports past their expiry together with
+// their archives.
+func (r *DataExportRepository) DeleteExpiredExports(ctx context.Context, now time.Time) error {
+	return r.deleteExports(ctx, bson.M{"expiresAt": bson.M{"$lte": now}})
+}
+
+func (r *DataExportRepository) DeleteUserExports(ctx context.Context, userID primitive.ObjectID) error {
+	return r.deleteExports(ctx, bson.M{"userId": userID})
+}
+
+func (r *DataExportRepository) deleteExports(ctx context.Context, filter bson.M) error {
+	var exports []models.DataExport
+	cursor, err := r.Collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &exports); err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.FileID != nil {
+			if err := r.Files.DeleteContext(ctx, *export.FileID); err != nil && err != gridfs.ErrFileNotFound {
+				return err
+			}
+		}
+	}
+	_, err = r.Collection.DeleteMany(ctx, filter)
+	return err
+}
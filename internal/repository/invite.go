@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+type InviteCodeRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *InviteCodeRepository) CreateInviteCode(ctx context.Context, invite models.InviteCode) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, invite)
+}
+
+func (r *InviteCodeRepository) FindInviteCodes(ctx context.Context) ([]models.InviteCode, error) {
+	var invites []models.InviteCode
+	cursor, err := r.Collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// UseInviteCode counts one use of the code if it is still valid for the
+// given lowercase email, and returns it. mongo.ErrNoDocuments means the code
+// is unknown, revoked, expired, used up or locked to another address.
+func (r *InviteCodeRepository) UseInviteCode(ctx context.Context, codeHash, email string) (models.InviteCode, error) {
+	var invite models.InviteCode
+	filter := bson.M{
+		"codeHash":  codeHash,
+		"revokedAt": bson.M{"$exists": false},
+		"$expr":     bson.M{"$lt": bson.A{"$uses", "$maxUses"}},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"expiresAt": bson.M{"$exists": false}},
+				{"expiresAt": bson.M{"$gt": time.Now()}},
+			}},
+			{"$or": []bson.M{
+				{"email": bson.M{"$exists": false}},
+				{"email": email},
+			}},
+		},
+	}
+	update := bson.M{"$inc": bson.M{"uses": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	return invite, err
+}
+
+// ReleaseInviteCode gives back a use taken by UseInviteCode, e.g. when the
+// registration it was taken for failed.
+func (r *InviteCodeRepository) ReleaseInviteCode(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "uses": bson.M{"$gt": 0}}
+	_, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": -1}})
+	return err
+}
+
+// RevokeInviteCode reports whether an unrevoked code matched.
+func (r *InviteCodeRepository) RevokeInviteCode(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}}
+	result, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+type JoinRequestRepository struct {
+	Collection *mongo.Collection
+}
+
+// CreateJoinRequest files the request unless the user already has one
+// pending for the channel, and reports whether it was created.
+func (r *JoinRequestRepository) CreateJoinRequest(ctx context.Context, request models.JoinRequest) (bool, error) {
+	filter := bson.M{"channelId": request.ChannelID, "userId": request.UserID, "status": models.JoinRequestPending}
+	update := bson.M{"$setOnInsert": request}
+	result, err := r.Collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount == 1, nil
+}
+
+// FindJoinRequests lists the channel's requests, newest first. An empty
+// status lists all of them.
+func (r *JoinRequestRepository) FindJoinRequests(ctx context.Context, channelID primitive.ObjectID, status string) ([]models.JoinRequest, error) {
+	var requests []models.JoinRequest
+	filter := bson.M{"channelId": channelID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *JoinRequestRepository) FindJoinRequest(ctx context.Context, channelID, id primitive.ObjectID) (models.JoinRequest, error) {
+	var request models.JoinRequest
+	err := r.Collection.FindOne(ctx, bson.M{"_id": id, "channelId": channelID}).Decode(&request)
+	return request, err
+}
+
+// DecideJoinRequest records the decision on a pending request of the
+// channel and returns the request. mongo.ErrNoDocuments means there is no
+// such pending request.
+func (r *JoinRequestRepository) DecideJoinRequest(ctx context.Context, channelID, id primitive.ObjectID, status string, decidedBy primitive.ObjectID) (models.JoinRequest, error) {
+	var request models.JoinRequest
+	filter := bson.M{"_id": id, "channelId": channelID, "status": models.JoinRequestPending}
+	update := bson.M{"$set": bson.M{"status": status, "decidedBy": decidedBy, "decidedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&request)
+	return request, err
+}
+
+// ReopenJoinRequest puts a decided request back to pending, e.g. when
+// adding the approved user to the channel failed.
+func (r *JoinRequestRepository) ReopenJoinRequest(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"status": models.JoinRequestPending},
+		"$unset": bson.M{"decidedBy": "", "decidedAt": ""},
+	}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// CancelUserJoinRequests cancels the user's pending requests.
+func (r *JoinRequestRepository) CancelUserJoinRequests(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"userId": userID, "status": models.JoinRequestPending}
+	update := bson.M{"$set": bson.M{"status": models.JoinRequestCancelled, "decidedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
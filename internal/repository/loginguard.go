@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+type LoginThrottleRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *LoginThrottleRepository) FindThrottles(ctx context.Context, keys []string) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	cursor, err := r.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &throttles); err != nil {
+		return nil, err
+	}
+	return throttles, nil
+}
+
+// RecordFailure atomically counts a failed attempt for key and returns the
+// updated counter. Failures older than window no longer count, so the
+// counter starts over. A non-empty ip is remembered with the counter.
+func (r *LoginThrottleRepository) RecordFailure(ctx context.Context, key, ip string, window time.Duration) (models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	now := time.Now()
+	stale := bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$lastFailureAt", time.Time{}}}, now.Add(-window)}}
+	set := bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			stale,
+			1,
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		}},
+		"lastFailureAt": now,
+	}
+	if ip != "" {
+		set["ips"] = bson.M{"$cond": bson.A{
+			stale,
+			bson.A{ip},
+			bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$ips", bson.A{}}}, bson.A{ip}}},
+		}}
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&throttle)
+	return throttle, err
+}
+
+// Lock blocks key until the given time and reports whether it was not
+// already locked, so callers can act once per lockout.
+func (r *LoginThrottleRepository) Lock(ctx context.Context, key string, until time.Time) (bool, error) {
+	filter := bson.M{"_id": key, "$or": bson.A{
+		bson.M{"lockedUntil": bson.M{"$exists": false}},
+		bson.M{"lockedUntil": bson.M{"$lte": time.Now()}},
+	}}
+	update := bson.M{"$set": bson.M{"lockedUntil": until}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// SetUnlockID records the ID of the unlock link mailed for key's lockout,
+// replacing any earlier one.
+func (r *LoginThrottleRepository) SetUnlockID(ctx context.Context, key, unlockID string) error {
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"unlockId": unlockID}})
+	return err
+}
+
+// ConsumeUnlock deletes key's counter if unlockID is its current unlock
+// link and returns it, so each link works once.
+func (r *LoginThrottleRepository) ConsumeUnlock(ctx context.Context, key, unlockID string) (models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.Collection.FindOneAndDelete(ctx, bson.M{"_id": key, "unlockId": unlockID}).Decode(&throttle)
+	return throttle, err
+}
+
+func (r *LoginThrottleRepository) Reset(ctx context.Context, keys ...string) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	return err
+}
+
+type LoginEventRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *LoginEventRepository) CreateEvent(ctx context.Context, event models.LoginEvent) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, event)
+}
+
+func (r *LoginEventRepository) DeleteUserEvents(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"time"
+)
+
+type OIDCStateRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *OIDCStateRepository) CreateState(ctx context.Context, state models.OIDCLoginState) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, state)
+}
+
+// ConsumeState deletes and returns an unexpired login state, so every
+// authorization response can be redeemed at most once.
+func (r *OIDCStateRepository) ConsumeState(ctx context.Context, state string) (models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	filter := bson.M{"state": state, "expiresAt": bson.M{"$gt": time.Now()}}
+	err := r.Collection.FindOneAndDelete(ctx, filter).Decode(&loginState)
+	return loginState, err
+}
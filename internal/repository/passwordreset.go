@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"time"
+)
+
+type PasswordResetRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *PasswordResetRepository) CreateResetToken(ctx context.Context, token models.PasswordResetToken) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, token)
+}
+
+// FindResetToken returns an unused, unexpired token without consuming it.
+func (r *PasswordResetRepository) FindResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	err := r.Collection.FindOne(ctx, filter).Decode(&token)
+	return token, err
+}
+
+// ConsumeResetToken marks an unused, unexpired token as used and returns it.
+func (r *PasswordResetRepository) ConsumeResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	now := time.Now()
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": now}}
+	err := r.Collection.FindOneAndUpdate(ctx, filter, update).Decode(&token)
+	return token, err
+}
+
+// InvalidateUserTokens marks every outstanding token of the user as used, so
+// only the most recently mailed link works.
+func (r *PasswordResetRepository) InvalidateUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"userId": userID, "usedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *PasswordResetRepository) DeleteUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
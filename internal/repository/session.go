@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"pwa/internal/models"
+	"time"
+)
+
+// sessionTouchInterval limits how often LastSeenAt is written for a session.
+const sessionTouchInterval = time.Minute
+
+type SessionRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session models.Session) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, session)
+}
+
+// notExpired matches sessions without an expiry, i.e. every session except
+// impersonations, or whose expiry has not passed.
+func notExpired() []bson.M {
+	return []bson.M{
+		{"expiresAt": bson.M{"$exists": false}},
+		{"expiresAt": bson.M{"$gt": time.Now()}},
+	}
+}
+
+// FindActiveSession returns the session with the given hex ID unless it has
+// been revoked or has expired.
+func (r *SessionRepository) FindActiveSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return session, err
+	}
+	filter := bson.M{"_id": objID, "revokedAt": bson.M{"$exists": false}, "$or": notExpired()}
+	err = r.Collection.FindOne(ctx, filter).Decode(&session)
+	return session, err
+}
+
+func (r *SessionRepository) FindActiveSessionsByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	var sessions []models.Session
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}, "$or": notExpired()}
+	opts := options.Find().SetSort(bson.M{"lastSeenAt": -1})
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch records activity on a session. Writes are skipped when the session
+// was already seen within sessionTouchInterval.
+func (r *SessionRepository) Touch(ctx context.Context, id primitive.ObjectID, ip, userAgent string) error {
+	now := time.Now()
+	filter := bson.M{"_id": id, "lastSeenAt": bson.M{"$lt": now.Add(-sessionTouchInterval)}}
+	set := bson.M{"lastSeenAt": now, "ip": ip}
+	if userAgent != "" {
+		set["userAgent"] = userAgent
+	}
+	_, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	return err
+}
+
+// RevokeSession revokes one of the user's sessions and reports whether an
+// active session matched.
+func (r *SessionRepository) RevokeSession(ctx context.Context, id, userID primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "userId": userID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *SessionRepository) RevokeUserSessions(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *SessionRepository) DeleteUserSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+// FindImpersonationsByUserID lists every impersonation session opened on
+// the user's account, newest first, including ended ones.
+func (r *SessionRepository) FindImpersonationsByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	var sessions []models.Session
+	filter := bson.M{"userId": userID, "actorId": bson.M{"$exists": true}}
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -3,11 +3,11 @@ package repository
 import (
 	"context"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"pwa/internal/models"
+	"time"
 )
 
 type TodoListRepository struct {
@@ -26,11 +26,18 @@ func (r *TodoListRepository) FindTodoListByID(ctx context.Context, id string) (m
 	return todoList, err
 }
 
-func (r *TodoListRepository) UpdateTodoList(ctx context.Context, id string, todoList models.TodoList) (*mongo.UpdateResult, error) {
+func (r *TodoListRepository) UpdateTodoList(ctx context.Context, id string, request models.UpdateTodoListRequest) (*mongo.UpdateResult, error) {
+	set := bson.M{"updatedAt": time.Now()}
+	if request.Title != nil {
+		set["title"] = *request.Title
+	}
+	if request.Description != nil {
+		set["description"] = *request.Description
+	}
+
 	objID, _ := primitive.ObjectIDFromHex(id)
 	filter := bson.M{"_id": objID}
-	update := bson.M{"$set": todoList}
-	return r.Collection.UpdateOne(ctx, filter, update)
+	return r.Collection.UpdateOne(ctx, filter, bson.M{"$set": set})
 }
 
 func (r *TodoListRepository) DeleteTodoList(ctx context.Context, id string) (*mongo.DeleteResult, error) {
@@ -39,9 +46,12 @@ func (r *TodoListRepository) DeleteTodoList(ctx context.Context, id string) (*mo
 	return r.Collection.DeleteOne(ctx, filter)
 }
 
+// FindTodoListsByUserID returns every list the user owns, including lists in
+// channels they have since left.
 func (r *TodoListRepository) FindTodoListsByUserID(ctx context.Context, userID string) ([]models.TodoList, error) {
 	var todoLists []models.TodoList
-	filter := bson.M{"owner": userID}
+	objID, _ := primitive.ObjectIDFromHex(userID)
+	filter := bson.M{"owner": objID}
 	cursor, err := r.Collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
@@ -114,11 +124,57 @@ func (r *TodoListRepository) DeleteTask(ctx context.Context, todoListID string,
 	return err
 }
 
-func (r *TodoListRepository) GetTaskByID(c *gin.Context, todoListID string, taskID string) (models.Task, error) {
-	var task models.Task
-	tid, _ := primitive.ObjectIDFromHex(todoListID)
-	tkID, _ := primitive.ObjectIDFromHex(taskID)
-	filter := bson.M{"_id": tid, "tasks._id": tkID}
-	err := r.Collection.FindOne(c, filter).Decode(&task)
-	return task, err
+func (r *TodoListRepository) FindTodoListsByOwner(ctx context.Context, owner primitive.ObjectID) ([]models.TodoList, error) {
+	var todoLists []models.TodoList
+	cursor, err := r.Collection.Find(ctx, bson.M{"owner": owner})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &todoLists); err != nil {
+		return nil, err
+	}
+	return todoLists, nil
+}
+
+func (r *TodoListRepository) TransferOwnership(ctx context.Context, id, owner primitive.ObjectID) error {
+	update := bson.M{"$set": bson.M{"owner": owner, "updatedAt": time.Now()}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// FindTodoListsByContributor returns lists with at least one task last
+// updated by the user.
+func (r *TodoListRepository) FindTodoListsByContributor(ctx context.Context, userID primitive.ObjectID) ([]models.TodoList, error) {
+	var todoLists []models.TodoList
+	cursor, err := r.Collection.Find(ctx, bson.M{"tasks.updatedBy": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}(cursor, ctx)
+
+	if err = cursor.All(ctx, &todoLists); err != nil {
+		return nil, err
+	}
+	return todoLists, nil
+}
+
+func (r *TodoListRepository) DeleteTodoListsByChannelID(ctx context.Context, channelID string) error {
+	objID, err := primitive.ObjectIDFromHex(channelID)
+	if err != nil {
+		return err
+	}
+	_, err = r.Collection.DeleteMany(ctx, bson.M{"channelId": objID})
+	return err
 }
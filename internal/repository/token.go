@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"time"
+)
+
+type RefreshTokenRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, token models.RefreshToken) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, token)
+}
+
+func (r *RefreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.Collection.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&token)
+	return token, err
+}
+
+// MarkUsed flags the token as consumed. It reports false when the token had
+// already been used or revoked, which callers treat as a replay.
+func (r *RefreshTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id":       id,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	filter := bson.M{"familyId": familyID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *RefreshTokenRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+	_, err := r.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *RefreshTokenRepository) DeleteUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
@@ -6,7 +6,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"pwa/internal/models"
+	"regexp"
+	"time"
 )
 
 type UserRepository struct {
@@ -22,9 +25,10 @@ func (r *UserRepository) CreateUser(ctx context.Context, user models.User) (*mon
 	return result, nil
 }
 
+// FindUsers returns every user without their password hash.
 func (r *UserRepository) FindUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	cursor, err := r.Collection.Find(ctx, bson.M{})
+	cursor, err := r.Collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"password": 0}))
 	if err != nil {
 		return nil, err
 	}
@@ -47,6 +51,277 @@ func (r *UserRepository) FindUserByIdentifier(ctx context.Context, identifier st
 	return user, err
 }
 
+func (r *UserRepository) FindUserByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := r.Collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	return user, err
+}
+
+func (r *UserRepository) FindUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var user models.User
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}}
+	err := r.Collection.FindOne(ctx, filter).Decode(&user)
+	return user, err
+}
+
+func (r *UserRepository) AddIdentity(ctx context.Context, id primitive.ObjectID, identity models.ExternalIdentity) error {
+	update := bson.M{"$push": bson.M{"identities": identity}, "$set": bson.M{"updatedAt": time.Now()}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *UserRepository) FindUserByID(ctx context.Context, id string) (models.User, error) {
+	var user models.User
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return user, fmt.Errorf("invalid id format: %w", err)
+	}
+	err = r.Collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	return user, err
+}
+
+// MarkEmailVerified flags the user as verified if their email is still the
+// one the verification link was issued for.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string) (bool, error) {
+	now := time.Now()
+	filter := bson.M{"_id": id, "email": email}
+	update := bson.M{"$set": bson.M{"verified": true, "verifiedAt": now, "updatedAt": now}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// SetPendingTOTPSecret starts a TOTP enrollment. It reports false when the
+// user already has two-factor authentication enabled.
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) (bool, error) {
+	filter := bson.M{"_id": id, "mfa.enabled": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"mfa.enabled": false, "mfa.pendingTotpSecret": secret, "updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func (r *UserRepository) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodes []string) error {
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"mfa": models.MFASettings{
+		Enabled:       true,
+		TOTPSecret:    secret,
+		RecoveryCodes: recoveryCodes,
+		LastUsedStep:  step,
+		EnabledAt:     &now,
+	}, "updatedAt": now}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *UserRepository) DisableMFA(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"mfa": ""}, "$set": bson.M{"updatedAt": time.Now()}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// UseTOTPStep records step as the last accepted TOTP step. It reports false
+// when that step, or a later one, was already used.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	filter := bson.M{"_id": id, "mfa.lastUsedStep": bson.M{"$lt": step}}
+	update := bson.M{"$set": bson.M{"mfa.lastUsedStep": step}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the hashed recovery code and reports whether it
+// was present.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+	filter := bson.M{"_id": id, "mfa.recoveryCodes": codeHash}
+	update := bson.M{"$pull": bson.M{"mfa.recoveryCodes": codeHash}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *UserRepository) AddPasskey(ctx context.Context, id primitive.ObjectID, credential models.WebAuthnCredential) error {
+	update := bson.M{"$push": bson.M{"webauthnCredentials": credential}, "$set": bson.M{"updatedAt": time.Now()}}
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// RecordPasskeyUse stores the authenticator's new signature counter after a
+// successful assertion.
+func (r *UserRepository) RecordPasskeyUse(ctx context.Context, id primitive.ObjectID, credentialID []byte, signCount uint32, cloneWarning bool) error {
+	filter := bson.M{"_id": id, "webauthnCredentials.id": credentialID}
+	update := bson.M{"$set": bson.M{
+		"webauthnCredentials.$.signCount":    signCount,
+		"webauthnCredentials.$.cloneWarning": cloneWarning,
+		"webauthnCredentials.$.lastUsedAt":   time.Now(),
+	}}
+	_, err := r.Collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RemovePasskey deletes one of the user's credentials and reports whether it
+// existed.
+func (r *UserRepository) RemovePasskey(ctx context.Context, id primitive.ObjectID, credentialID []byte) (bool, error) {
+	filter := bson.M{"_id": id, "webauthnCredentials.id": credentialID}
+	update := bson.M{"$pull": bson.M{"webauthnCredentials": bson.M{"id": credentialID}}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// SetRole changes the user's global role and reports whether the user
+// exists.
+func (r *UserRepository) SetRole(ctx context.Context, id primitive.ObjectID, role string) (bool, error) {
+	update := bson.M{"$set": bson.M{"role": role, "updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func (r *UserRepository) CountAdmins(ctx context.Context) (int64, error) {
+	return r.Collection.CountDocuments(ctx, bson.M{"role": models.RoleAdmin})
+}
+
+// ScheduleDeletion marks the account for deletion at the given time and
+// reports whether it was not already scheduled.
+func (r *UserRepository) ScheduleDeletion(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "deletionScheduledAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"deletionScheduledAt": at, "updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// CancelDeletion reports whether a scheduled deletion was cancelled.
+func (r *UserRepository) CancelDeletion(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "deletionScheduledAt": bson.M{"$exists": true}}
+	update := bson.M{"$unset": bson.M{"deletionScheduledAt": ""}, "$set": bson.M{"updatedAt": time.Now()}}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *UserRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]models.User, error) {
+	var users []models.User
+	cursor, err := r.Collection.Find(ctx, bson.M{"deletionScheduledAt": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindUsersByIDs returns the users with the given IDs that exist, in no
+// particular order.
+func (r *UserRepository) FindUsersByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	var users []models.User
+	cursor, err := r.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindDirectoryPage returns up to limit users whose username or display
+// name starts with prefix, case-insensitively, ordered by username and then
+// ID. Only the fields of a public profile are loaded. When afterUsername is
+// set, the page starts after that user.
+func (r *UserRepository) FindDirectoryPage(ctx context.Context, prefix, afterUsername string, afterID primitive.ObjectID, limit int64) ([]models.User, error) {
+	filter := bson.M{"deletionScheduledAt": bson.M{"$exists": false}}
+	var and []bson.M
+	if prefix != "" {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix), Options: "i"}
+		and = append(and, bson.M{"$or": []bson.M{{"username": pattern}, {"displayName": pattern}}})
+	}
+	if afterUsername != "" {
+		and = append(and, bson.M{"$or": []bson.M{
+			{"username": bson.M{"$gt": afterUsername}},
+			{"username": afterUsername, "_id": bson.M{"$gt": afterID}},
+		}})
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "username", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"username": 1, "displayName": 1, "avatarId": 1})
+
+	var users []models.User
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetAvatar points the user at a new avatar file, or none when avatarID is
+// nil, and returns the ID of the file it replaced.
+func (r *UserRepository) SetAvatar(ctx context.Context, id primitive.ObjectID, avatarID *primitive.ObjectID) (*primitive.ObjectID, error) {
+	update := bson.M{"$set": bson.M{"avatarId": avatarID, "updatedAt": time.Now()}}
+	if avatarID == nil {
+		update = bson.M{"$unset": bson.M{"avatarId": ""}, "$set": bson.M{"updatedAt": time.Now()}}
+	}
+
+	var previous models.User
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"avatarId": 1})
+	if err := r.Collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&previous); err != nil {
+		return nil, err
+	}
+	return previous.AvatarID, nil
+}
+
+// ReplacePasswordHash swaps the stored hash for an equivalent one, unless
+// the password was changed in the meantime.
+func (r *UserRepository) ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	filter := bson.M{"_id": id, "password": oldHash}
+	_, err := r.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"password": newHash}})
+	return err
+}
+
 func (r *UserRepository) UpdateUser(ctx context.Context, filter bson.M, update bson.M) (*mongo.UpdateResult, error) {
 	return r.Collection.UpdateOne(ctx, filter, update)
 }
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"time"
+)
+
+type WebAuthnChallengeRepository struct {
+	Collection *mongo.Collection
+}
+
+func (r *WebAuthnChallengeRepository) CreateChallenge(ctx context.Context, challenge models.WebAuthnChallenge) (*mongo.InsertOneResult, error) {
+	return r.Collection.InsertOne(ctx, challenge)
+}
+
+// ConsumeChallenge deletes and returns an unexpired challenge for the given
+// ceremony, so each challenge can be answered at most once.
+func (r *WebAuthnChallengeRepository) ConsumeChallenge(ctx context.Context, id, ceremony string) (models.WebAuthnChallenge, error) {
+	var challenge models.WebAuthnChallenge
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return challenge, mongo.ErrNoDocuments
+	}
+	filter := bson.M{"_id": objID, "ceremony": ceremony, "expiresAt": bson.M{"$gt": time.Now()}}
+	err = r.Collection.FindOneAndDelete(ctx, filter).Decode(&challenge)
+	return challenge, err
+}
@@ -49,7 +49,7 @@ func (r *WebPushRepository) DeleteWebPushSubscription(ctx context.Context, id st
 
 func (r *WebPushRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.WebPushSubscription, error) {
 	var subscriptions []models.WebPushSubscription
-	filter := bson.M{"userID": userID}
+	filter := bson.M{"userId": userID}
 	cursor, err := r.Collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
@@ -66,3 +66,8 @@ func (r *WebPushRepository) FindByUserID(ctx context.Context, userID primitive.O
 	}
 	return subscriptions, nil
 }
+
+func (r *WebPushRepository) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from JWTs (and spotted by secret scanners).
+const AccessTokenPrefix = "pwa_pat_"
+
+var (
+	ErrInvalidAccessToken  = errors.New("invalid or expired access token")
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrInvalidExpiry       = errors.New("expiry must be in the future")
+)
+
+type AccessTokenService struct {
+	tokens *repository.AccessTokenRepository
+	users  *repository.UserRepository
+}
+
+func NewAccessTokenService(tokens *repository.AccessTokenRepository, users *repository.UserRepository) *AccessTokenService {
+	return &AccessTokenService{tokens: tokens, users: users}
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// Create issues a token for the user. The plaintext token is only returned
+// here and cannot be recovered later.
+func (s *AccessTokenService) Create(ctx context.Context, userID primitive.ObjectID, request models.CreateAccessTokenRequest) (models.PersonalAccessToken, string, error) {
+	if len(request.Scopes) == 0 {
+		return models.PersonalAccessToken{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range request.Scopes {
+		if !containsString(models.AccessTokenScopes, scope) {
+			return models.PersonalAccessToken{}, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return models.PersonalAccessToken{}, "", ErrInvalidExpiry
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return models.PersonalAccessToken{}, "", err
+	}
+	plaintext := AccessTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      request.Name,
+		Prefix:    plaintext[:len(AccessTokenPrefix)+4],
+		TokenHash: hashToken(plaintext),
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.tokens.CreateAccessToken(ctx, token); err != nil {
+		return models.PersonalAccessToken{}, "", err
+	}
+	return token, plaintext, nil
+}
+
+// Authenticate resolves a plaintext token presented in a request. Tokens of
+// deleted accounts are rejected.
+func (s *AccessTokenService) Authenticate(ctx context.Context, plaintext string) (models.PersonalAccessToken, error) {
+	token, err := s.tokens.FindActiveByHash(ctx, hashToken(plaintext))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return token, ErrInvalidAccessToken
+	} else if err != nil {
+		return token, err
+	}
+
+	if _, err := s.users.FindUserByID(ctx, token.UserID.Hex()); errors.Is(err, mongo.ErrNoDocuments) {
+		return models.PersonalAccessToken{}, ErrInvalidAccessToken
+	} else if err != nil {
+		return models.PersonalAccessToken{}, err
+	}
+
+	if err := s.tokens.Touch(ctx, token.ID); err != nil {
+		log.Printf("Failed to update access token %s: %v", token.ID.Hex(), err)
+	}
+	return token, nil
+}
+
+func (s *AccessTokenService) List(ctx context.Context, userID primitive.ObjectID) ([]models.PersonalAccessToken, error) {
+	return s.tokens.FindActiveByUserID(ctx, userID)
+}
+
+func (s *AccessTokenService) Revoke(ctx context.Context, userID primitive.ObjectID, tokenID string) error {
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return ErrAccessTokenNotFound
+	}
+	ok, err := s.tokens.RevokeAccessToken(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
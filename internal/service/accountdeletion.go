@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"pwa/pkg/mailer"
+	"pwa/pkg/mongodb"
+	"time"
+)
+
+const (
+	defaultAccountDeletionGrace    = 30 * 24 * time.Hour
+	defaultAccountDeletionInterval = time.Hour
+)
+
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+)
+
+// AccountRepositories are the collections that hold data belonging to a
+// user account.
+type AccountRepositories struct {
+	Users          *repository.UserRepository
+	Sessions       *repository.SessionRepository
+	RefreshTokens  *repository.RefreshTokenRepository
+	AccessTokens   *repository.AccessTokenRepository
+	PasswordResets *repository.PasswordResetRepository
+	LoginEvents    *repository.LoginEventRepository
+	Channels       *repository.ChannelRepository
+	TodoLists      *repository.TodoListRepository
+	WebPush        *repository.WebPushRepository
+	DataExports    *repository.DataExportRepository
+	Avatars        *repository.AvatarRepository
+	JoinRequests   *repository.JoinRequestRepository
+}
+
+type AccountDeletionService struct {
+	client   *mongo.Client
+	repos    AccountRepositories
+	channels *ChannelLifecycleService
+	mailer   mailer.Mailer
+	grace    time.Duration
+	interval time.Duration
+}
+
+// NewAccountDeletionService builds the service. Accounts are deleted
+// ACCOUNT_DELETION_GRACE (default 30 days) after the request, checked every
+// ACCOUNT_DELETION_INTERVAL (default one hour).
+func NewAccountDeletionService(client *mongo.Client, repos AccountRepositories, channels *ChannelLifecycleService, m mailer.Mailer) *AccountDeletionService {
+	return &AccountDeletionService{
+		client:   client,
+		repos:    repos,
+		channels: channels,
+		mailer:   m,
+		grace:    envconfig.Duration("ACCOUNT_DELETION_GRACE", defaultAccountDeletionGrace),
+		interval: envconfig.Duration("ACCOUNT_DELETION_INTERVAL", defaultAccountDeletionInterval),
+	}
+}
+
+// Schedule marks the user's account for deletion after the grace period and
+// returns when it will happen.
+func (s *AccountDeletionService) Schedule(ctx context.Context, user models.User) (time.Time, error) {
+	at := time.Now().Add(s.grace)
+	ok, err := s.repos.Users.ScheduleDeletion(ctx, user.ID, at)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, ErrDeletionAlreadyScheduled
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nAs requested, your account and its data will be deleted on %s.\n\n"+
+			"Changed your mind? Sign in and cancel the deletion before then.\n", user.Username, at.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("Failed to send deletion notice to user %s: %v", user.ID.Hex(), err)
+	}
+	return at, nil
+}
+
+func (s *AccountDeletionService) Cancel(ctx context.Context, userID primitive.ObjectID) error {
+	ok, err := s.repos.Users.CancelDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// Run deletes accounts whose grace period is over until ctx is cancelled.
+func (s *AccountDeletionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.deleteDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *AccountDeletionService) deleteDue(ctx context.Context) {
+	users, err := s.repos.Users.FindUsersDueForDeletion(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to look up accounts due for deletion: %v", err)
+		return
+	}
+	for _, user := range users {
+		if err := s.Delete(ctx, user.ID); err != nil {
+			log.Printf("Failed to delete account %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		log.Printf("Deleted account %s", user.ID.Hex())
+	}
+}
+
+// Delete removes the account and everything attached to it in one
+// transaction. Todo lists in a channel are handed to the longest-standing
+// remaining member; other lists are deleted. Channels the user owns pass to
+// their successor, channels left empty fall under the empty channel policy,
+// and pending join requests are cancelled.
+func (s *AccountDeletionService) Delete(ctx context.Context, userID primitive.ObjectID) error {
+	return mongodb.WithTransaction(ctx, s.client, func(ctx context.Context) error {
+		if err := s.releaseTodoLists(ctx, userID); err != nil {
+			return err
+		}
+		channels, err := s.handOverChannels(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.repos.Channels.RemoveMemberFromAll(ctx, userID.Hex()); err != nil {
+			return err
+		}
+		for _, channel := range channels {
+			if err := s.channels.MarkIfEmpty(ctx, channel.ID); err != nil {
+				return err
+			}
+		}
+		if err := s.repos.JoinRequests.CancelUserJoinRequests(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.WebPush.DeleteByUserID(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.Sessions.DeleteUserSessions(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.RefreshTokens.DeleteUserTokens(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.AccessTokens.DeleteUserTokens(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.PasswordResets.DeleteUserTokens(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.LoginEvents.DeleteUserEvents(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.DataExports.DeleteUserExports(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repos.Avatars.DeleteUserAvatars(ctx, userID); err != nil {
+			return err
+		}
+		_, err = s.repos.Users.DeleteUser(ctx, userID.Hex())
+		return err
+	})
+}
+
+// handOverChannels passes the channels the user owns to their successors
+// and returns every channel the user is a member of.
+func (s *AccountDeletionService) handOverChannels(ctx context.Context, userID primitive.ObjectID) ([]models.Channel, error) {
+	channels, err := s.repos.Channels.FindChannelsByUserID(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if err := s.channels.HandOver(ctx, channel, userID.Hex()); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+func (s *AccountDeletionService) releaseTodoLists(ctx context.Context, userID primitive.ObjectID) error {
+	todoLists, err := s.repos.TodoLists.FindTodoListsByOwner(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, todoList := range todoLists {
+		if todoList.ChannelID != nil {
+			successor, err := s.successor(ctx, *todoList.ChannelID, userID)
+			if err != nil {
+				return err
+			}
+			if successor != nil {
+				if err := s.repos.TodoLists.TransferOwnership(ctx, todoList.ID, *successor); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if _, err := s.repos.TodoLists.DeleteTodoList(ctx, todoList.ID.Hex()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// successor returns the first other member of the channel, or nil when
+// there is none.
+func (s *AccountDeletionService) successor(ctx context.Context, channelID, userID primitive.ObjectID) (*primitive.ObjectID, error) {
+	members, err := s.repos.Channels.GetChannelMembers(ctx, channelID.Hex())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		id, err := primitive.ObjectIDFromHex(member)
+		if err == nil && id != userID {
+			return &id, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"time"
+)
+
+// ChannelInvitePrefix marks channel invite tokens so they are recognisable
+// when pasted.
+const ChannelInvitePrefix = "pwa_chi_"
+
+const defaultChannelInviteTTL = 7 * 24 * time.Hour
+
+var (
+	ErrChannelInviteNotFound = errors.New("channel invite not found")
+	ErrInvalidChannelInvite  = errors.New("invalid, expired or used up invite link")
+	ErrInvalidInviteSettings = errors.New("invalid invite link settings")
+	ErrInviteRoleNotAllowed  = errors.New("invite links can only grant roles ranked below your own")
+	ErrAlreadyChannelMember  = errors.New("already a member of this channel")
+	ErrChannelBanned         = errors.New("you are banned from this channel")
+)
+
+// CheckJoin reports why userID cannot join channel, or nil if nothing
+// stands in the way.
+func CheckJoin(channel models.Channel, userID string) error {
+	switch {
+	case channel.MemberRole(userID) != "":
+		return ErrAlreadyChannelMember
+	case channel.IsBanned(userID):
+		return ErrChannelBanned
+	case channel.ArchivedAt != nil:
+		return ErrChannelArchived
+	}
+	return nil
+}
+
+// joinRejection explains an ErrChannelNotJoined from JoinChannel by
+// reloading the channel, which changed after it was last checked.
+func joinRejection(ctx context.Context, channels *repository.ChannelRepository, channelID, userID string) error {
+	channel, err := channels.FindChannelByID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if err := CheckJoin(channel, userID); err != nil {
+		return err
+	}
+	return repository.ErrChannelNotJoined
+}
+
+type ChannelInviteService struct {
+	invites  *repository.ChannelInviteRepository
+	channels *repository.ChannelRepository
+	ttl      time.Duration
+}
+
+// NewChannelInviteService builds the service. Links without an explicit
+// expiry stay valid for CHANNEL_INVITE_TTL (default 7 days).
+func NewChannelInviteService(invites *repository.ChannelInviteRepository, channels *repository.ChannelRepository) *ChannelInviteService {
+	return &ChannelInviteService{
+		invites:  invites,
+		channels: channels,
+		ttl:      envconfig.Duration("CHANNEL_INVITE_TTL", defaultChannelInviteTTL),
+	}
+}
+
+// Create issues an invite link to the channel and returns it with its
+// token, which is not stored. The creator can only grant roles ranked below
+// their own.
+func (s *ChannelInviteService) Create(ctx context.Context, channel models.Channel, creatorID primitive.ObjectID, request models.CreateChannelInviteRequest) (models.ChannelInvite, string, error) {
+	role := request.Role
+	if role == "" {
+		role = models.ChannelRoleMember
+	}
+	if !models.ChannelRoleOutranks(channel.MemberRole(creatorID.Hex()), role) {
+		return models.ChannelInvite{}, "", ErrInviteRoleNotAllowed
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(now) {
+			return models.ChannelInvite{}, "", fmt.Errorf("%w: expiry must be in the future", ErrInvalidInviteSettings)
+		}
+		expiresAt = *request.ExpiresAt
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return models.ChannelInvite{}, "", err
+	}
+	token := ChannelInvitePrefix + secret
+
+	invite := models.ChannelInvite{
+		ID:        primitive.NewObjectID(),
+		ChannelID: channel.ID,
+		TokenHash: hashToken(token),
+		Prefix:    token[:len(ChannelInvitePrefix)+4],
+		Role:      role,
+		MaxUses:   request.MaxUses,
+		CreatedBy: creatorID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if _, err := s.invites.CreateChannelInvite(ctx, invite); err != nil {
+		return models.ChannelInvite{}, "", err
+	}
+	return invite, token, nil
+}
+
+func (s *ChannelInviteService) List(ctx context.Context, channelID primitive.ObjectID) ([]models.ChannelInvite, error) {
+	invites, err := s.invites.FindChannelInvites(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if invites == nil {
+		invites = []models.ChannelInvite{}
+	}
+	return invites, nil
+}
+
+func (s *ChannelInviteService) Revoke(ctx context.Context, channelID primitive.ObjectID, inviteID string) error {
+	id, err := primitive.ObjectIDFromHex(inviteID)
+	if err != nil {
+		return ErrChannelInviteNotFound
+	}
+	ok, err := s.invites.RevokeChannelInvite(ctx, channelID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrChannelInviteNotFound
+	}
+	return nil
+}
+
+// Accept adds the user to the channel the link points to, with the role it
+// grants. Members who open a link keep their role and do not use it up.
+func (s *ChannelInviteService) Accept(ctx context.Context, token, userID string) (models.Channel, string, error) {
+	invite, err := s.invites.UseChannelInvite(ctx, hashToken(token))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Channel{}, "", ErrInvalidChannelInvite
+	} else if err != nil {
+		return models.Channel{}, "", err
+	}
+
+	channel, err := s.channels.FindChannelByID(ctx, invite.ChannelID.Hex())
+	if err != nil {
+		s.release(ctx, invite)
+		return models.Channel{}, "", ErrInvalidChannelInvite
+	}
+	if err := CheckJoin(channel, userID); err != nil {
+		s.release(ctx, invite)
+		return channel, "", err
+	}
+
+	err = s.channels.JoinChannel(ctx, channel.ID.Hex(), userID, invite.Role)
+	if errors.Is(err, repository.ErrChannelNotJoined) {
+		err = joinRejection(ctx, s.channels, channel.ID.Hex(), userID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = ErrInvalidChannelInvite
+		}
+	}
+	if err != nil {
+		s.release(ctx, invite)
+		return channel, "", err
+	}
+	return channel, invite.Role, nil
+}
+
+func (s *ChannelInviteService) release(ctx context.Context, invite models.ChannelInvite) {
+	if err := s.invites.ReleaseChannelInvite(ctx, invite.ID); err != nil {
+		log.Printf("Failed to release channel invite %s: %v", invite.ID.Hex(), err)
+	}
+}
+
+// Link is the PWA page that accepts the invite with the given token.
+func (s *ChannelInviteService) Link(token string) string {
+	return appURL("/invites/" + token)
+}
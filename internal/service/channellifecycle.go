@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"pwa/pkg/mongodb"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEmptyChannelRetentionDays = 30
+	emptyChannelSweep                = time.Hour
+)
+
+var (
+	ErrInvalidNewOwner = errors.New("the new owner must be another member of the channel")
+	ErrChannelArchived = errors.New("this channel is archived")
+)
+
+type ChannelLifecycleService struct {
+	client    *mongo.Client
+	channels  *repository.ChannelRepository
+	todoLists *repository.TodoListRepository
+	policy    string
+	retention time.Duration
+}
+
+// EmptyChannelPolicyFromEnv reads CHANNEL_EMPTY_POLICY, which is one of keep
+// (the default), archive or delete.
+func EmptyChannelPolicyFromEnv() (string, error) {
+	policy := strings.TrimSpace(os.Getenv("CHANNEL_EMPTY_POLICY"))
+	switch policy {
+	case "":
+		return models.EmptyChannelKeep, nil
+	case models.EmptyChannelKeep, models.EmptyChannelArchive, models.EmptyChannelDelete:
+		return policy, nil
+	}
+	return "", fmt.Errorf("CHANNEL_EMPTY_POLICY must be %s, %s or %s, got %q",
+		models.EmptyChannelKeep, models.EmptyChannelArchive, models.EmptyChannelDelete, policy)
+}
+
+// NewChannelLifecycleService builds the service. Under the delete policy,
+// channels are deleted CHANNEL_EMPTY_RETENTION_DAYS (default 30) after their
+// last member left.
+func NewChannelLifecycleService(client *mongo.Client, policy string, channels *repository.ChannelRepository, todoLists *repository.TodoListRepository) *ChannelLifecycleService {
+	days := envconfig.Int("CHANNEL_EMPTY_RETENTION_DAYS", defaultEmptyChannelRetentionDays)
+	return &ChannelLifecycleService{
+		client:    client,
+		channels:  channels,
+		todoLists: todoLists,
+		policy:    policy,
+		retention: time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+// Transfer makes another member the owner of the channel. The previous
+// owner stays on as an admin.
+func (s *ChannelLifecycleService) Transfer(ctx context.Context, channel models.Channel, ownerID, newOwnerID string) error {
+	role := channel.MemberRole(newOwnerID)
+	if role == "" || newOwnerID == ownerID {
+		return ErrInvalidNewOwner
+	}
+
+	// Members from before roles existed need a membership entry to be
+	// promoted.
+	if !hasMembership(channel, newOwnerID) {
+		if _, err := s.channels.SetMemberRole(ctx, channel.ID.Hex(), newOwnerID, role); err != nil {
+			return err
+		}
+	}
+
+	ok, err := s.channels.TransferOwnership(ctx, channel.ID.Hex(), ownerID, newOwnerID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidNewOwner
+	}
+	return nil
+}
+
+// HandOver passes the channel on to its successor if the user owns it, so
+// it is not left without an owner when they go.
+func (s *ChannelLifecycleService) HandOver(ctx context.Context, channel models.Channel, userID string) error {
+	if channel.MemberRole(userID) != models.ChannelRoleOwner {
+		return nil
+	}
+	successor, ok := channel.Successor(userID)
+	if !ok {
+		return nil
+	}
+	if err := s.Transfer(ctx, channel, userID, successor.UserID); err != nil {
+		return err
+	}
+	log.Printf("Channel %s handed over from %s to %s", channel.ID.Hex(), userID, successor.UserID)
+	return nil
+}
+
+// Leave removes the user from the channel, handing it over first if they
+// own it, in one transaction. The last member leaving puts the empty
+// channel policy in motion.
+func (s *ChannelLifecycleService) Leave(ctx context.Context, channel models.Channel, userID string) error {
+	return mongodb.WithTransaction(ctx, s.client, func(ctx context.Context) error {
+		if err := s.HandOver(ctx, channel, userID); err != nil {
+			return err
+		}
+		if err := s.channels.LeaveChannel(ctx, channel.ID.Hex(), userID); err != nil {
+			return err
+		}
+		return s.MarkIfEmpty(ctx, channel.ID)
+	})
+}
+
+// MarkIfEmpty applies the empty channel policy to the channel if its last
+// member is gone.
+func (s *ChannelLifecycleService) MarkIfEmpty(ctx context.Context, channelID primitive.ObjectID) error {
+	if s.policy == models.EmptyChannelKeep {
+		return nil
+	}
+	return s.channels.MarkEmptyChannel(ctx, channelID, s.policy == models.EmptyChannelArchive)
+}
+
+// Run applies the empty channel policy, also to channels emptied by
+// account deletion, until ctx is cancelled.
+func (s *ChannelLifecycleService) Run(ctx context.Context) {
+	if s.policy == models.EmptyChannelKeep {
+		return
+	}
+
+	ticker := time.NewTicker(emptyChannelSweep)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ChannelLifecycleService) sweep(ctx context.Context) {
+	if err := s.channels.MarkEmptyChannels(ctx, s.policy == models.EmptyChannelArchive); err != nil {
+		log.Printf("Failed to mark empty channels: %v", err)
+		return
+	}
+	if s.policy != models.EmptyChannelDelete {
+		return
+	}
+
+	channels, err := s.channels.FindChannelsEmptySince(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		log.Printf("Failed to look up empty channels: %v", err)
+		return
+	}
+	for _, channel := range channels {
+		deleted := false
+		err := mongodb.WithTransaction(ctx, s.client, func(ctx context.Context) error {
+			var err error
+			deleted, err = s.channels.DeleteEmptyChannel(ctx, channel.ID)
+			if err != nil || !deleted {
+				return err
+			}
+			return s.todoLists.DeleteTodoListsByChannelID(ctx, channel.ID.Hex())
+		})
+		if err != nil {
+			log.Printf("Failed to delete empty channel %s: %v", channel.ID.Hex(), err)
+			continue
+		}
+		if deleted {
+			log.Printf("Deleted empty channel %s", channel.ID.Hex())
+		}
+	}
+}
+
+func hasMembership(channel models.Channel, userID string) bool {
+	for _, membership := range channel.Memberships {
+		if membership.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package service
+
+import "os"
+
+// appURL joins APP_BASE_URL, the address of the PWA front end, with path.
+func appURL(path string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	for len(base) > 0 && base[len(base)-1] == '/' {
+		base = base[:len(base)-1]
+	}
+	return base + path
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"io"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"time"
+)
+
+const (
+	defaultDataExportTTL = 7 * 24 * time.Hour
+	dataExportTimeout    = 10 * time.Minute
+	dataExportSweep      = time.Hour
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready yet")
+)
+
+// exportProfile is the account as included in an export. It leaves out the
+// password hash, TOTP secret and recovery codes.
+type exportProfile struct {
+	ID                  primitive.ObjectID        `json:"id"`
+	Username            string                    `json:"username"`
+	Email               string                    `json:"email"`
+	DisplayName         string                    `json:"displayName,omitempty"`
+	Timezone            string                    `json:"timezone,omitempty"`
+	Locale              string                    `json:"locale,omitempty"`
+	Role                string                    `json:"role"`
+	Verified            bool                      `json:"verified"`
+	VerifiedAt          *time.Time                `json:"verifiedAt,omitempty"`
+	MFAEnabled          bool                      `json:"mfaEnabled"`
+	Passkeys            []exportPasskey           `json:"passkeys,omitempty"`
+	Identities          []models.ExternalIdentity `json:"identities,omitempty"`
+	DeletionScheduledAt *time.Time                `json:"deletionScheduledAt,omitempty"`
+	CreatedAt           time.Time                 `json:"createdAt"`
+	UpdatedAt           time.Time                 `json:"updatedAt"`
+}
+
+type exportPasskey struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type exportChannel struct {
+	ID        primitive.ObjectID `json:"id"`
+	Name      string             `json:"name"`
+	Role      string             `json:"role"`
+	Members   []string           `json:"members"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+type exportTask struct {
+	TodoListID primitive.ObjectID `json:"todoListId"`
+	models.Task
+}
+
+type DataExportService struct {
+	exports *repository.DataExportRepository
+	repos   AccountRepositories
+	ttl     time.Duration
+}
+
+// NewDataExportService builds the service. Finished archives can be
+// downloaded for DATA_EXPORT_TTL (default 7 days).
+func NewDataExportService(exports *repository.DataExportRepository, repos AccountRepositories) *DataExportService {
+	return &DataExportService{
+		exports: exports,
+		repos:   repos,
+		ttl:     envconfig.Duration("DATA_EXPORT_TTL", defaultDataExportTTL),
+	}
+}
+
+// Request starts building an archive of the user's data in the background.
+// While one is still being built, that export is returned instead.
+func (s *DataExportService) Request(ctx context.Context, userID primitive.ObjectID) (models.DataExport, error) {
+	export, err := s.exports.FindUnfinishedExport(ctx, userID)
+	if err == nil {
+		return export, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return export, err
+	}
+
+	export = models.DataExport{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Status:    models.ExportStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.exports.CreateExport(ctx, export); err != nil {
+		return export, err
+	}
+
+	go s.build(export)
+	return export, nil
+}
+
+func (s *DataExportService) Get(ctx context.Context, userID primitive.ObjectID, exportID string) (models.DataExport, error) {
+	id, err := primitive.ObjectIDFromHex(exportID)
+	if err != nil {
+		return models.DataExport{}, ErrExportNotFound
+	}
+	export, err := s.exports.FindExport(ctx, id, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return export, ErrExportNotFound
+	}
+	return export, err
+}
+
+// Open returns a reader for a finished archive. The caller must close it.
+func (s *DataExportService) Open(ctx context.Context, userID primitive.ObjectID, exportID string) (models.DataExport, io.ReadCloser, error) {
+	export, err := s.Get(ctx, userID, exportID)
+	if err != nil {
+		return export, nil, err
+	}
+	if export.Status != models.ExportStatusReady || export.FileID == nil {
+		return export, nil, ErrExportNotReady
+	}
+	if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+		return export, nil, ErrExportNotFound
+	}
+
+	stream, err := s.exports.OpenArchive(*export.FileID)
+	if err != nil {
+		return export, nil, err
+	}
+	return export, stream, nil
+}
+
+// Run removes expired archives, and fails exports abandoned by a stopped
+// instance, until ctx is cancelled.
+func (s *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataExportSweep)
+	defer ticker.Stop()
+
+	for {
+		if err := s.exports.FailStaleExports(ctx, time.Now().Add(-2*dataExportTimeout)); err != nil {
+			log.Printf("Failed to clean up interrupted exports: %v", err)
+		}
+		if err := s.exports.DeleteExpiredExports(ctx, time.Now()); err != nil {
+			log.Printf("Failed to delete expired exports: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DataExportService) build(export models.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+	defer cancel()
+
+	if err := s.exports.SetStatus(ctx, export.ID, models.ExportStatusRunning, ""); err != nil {
+		log.Printf("Failed to start export %s: %v", export.ID.Hex(), err)
+	}
+
+	archive, err := s.archive(ctx, export.UserID)
+	if err != nil {
+		log.Printf("Failed to build export %s: %v", export.ID.Hex(), err)
+		if err := s.exports.SetStatus(ctx, export.ID, models.ExportStatusFailed, "failed to collect data"); err != nil {
+			log.Printf("Failed to update export %s: %v", export.ID.Hex(), err)
+		}
+		return
+	}
+
+	size := int64(len(archive))
+	fileID, err := s.exports.UploadArchive("export-"+export.ID.Hex()+".zip", bytes.NewReader(archive))
+	if err != nil {
+		log.Printf("Failed to store export %s: %v", export.ID.Hex(), err)
+		if err := s.exports.SetStatus(ctx, export.ID, models.ExportStatusFailed, "failed to store archive"); err != nil {
+			log.Printf("Failed to update export %s: %v", export.ID.Hex(), err)
+		}
+		return
+	}
+
+	if err := s.exports.MarkReady(ctx, export.ID, fileID, size, time.Now().Add(s.ttl)); err != nil {
+		log.Printf("Failed to update export %s: %v", export.ID.Hex(), err)
+	}
+}
+
+// archive collects the user's data into a zip of JSON files and their
+// avatar.
+func (s *DataExportService) archive(ctx context.Context, userID primitive.ObjectID) ([]byte, error) {
+	user, err := s.repos.Users.FindUserByID(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.repos.Channels.FindChannelsByUserID(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	exportedChannels := make([]exportChannel, 0, len(channels))
+	for _, channel := range channels {
+		exportedChannels = append(exportedChannels, exportChannel{
+			ID:        channel.ID,
+			Name:      channel.Name,
+			Role:      channel.MemberRole(userID.Hex()),
+			Members:   channel.Members,
+			CreatedAt: channel.CreatedAt,
+			UpdatedAt: channel.UpdatedAt,
+		})
+	}
+
+	owned, err := s.repos.TodoLists.FindTodoListsByOwner(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	contributed, err := s.repos.TodoLists.FindTodoListsByContributor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	todoLists := make([]models.TodoList, 0, len(owned)+len(contributed))
+	seen := make(map[primitive.ObjectID]bool)
+	for _, todoList := range append(owned, contributed...) {
+		if !seen[todoList.ID] {
+			seen[todoList.ID] = true
+			todoLists = append(todoLists, todoList)
+		}
+	}
+
+	tasks := []exportTask{}
+	for _, todoList := range todoLists {
+		for _, task := range todoList.Tasks {
+			if task.UpdatedBy == userID {
+				tasks = append(tasks, exportTask{TodoListID: todoList.ID, Task: task})
+			}
+		}
+	}
+
+	subscriptions, err := s.repos.WebPush.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptions == nil {
+		subscriptions = []models.WebPushSubscription{}
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", newExportProfile(user)},
+		{"channels.json", exportedChannels},
+		{"todolists.json", todoLists},
+		{"tasks.json", tasks},
+		{"push_subscriptions.json", subscriptions},
+	}
+	for _, file := range files {
+		f, err := w.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if user.AvatarID != nil {
+		if err := s.addAvatar(w, *user.AvatarID); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *DataExportService) addAvatar(w *zip.Writer, fileID primitive.ObjectID) error {
+	stream, err := s.repos.Avatars.OpenAvatar(fileID)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	f, err := w.Create("avatar.png")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, stream)
+	return err
+}
+
+func newExportProfile(user models.User) exportProfile {
+	profile := exportProfile{
+		ID:                  user.ID,
+		Username:            user.Username,
+		Email:               user.Email,
+		DisplayName:         user.DisplayName,
+		Timezone:            user.Timezone,
+		Locale:              user.Locale,
+		Role:                user.GlobalRole(),
+		Verified:            user.Verified,
+		VerifiedAt:          user.VerifiedAt,
+		MFAEnabled:          user.MFAEnabled(),
+		Identities:          user.Identities,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		CreatedAt:           user.CreatedAt,
+		UpdatedAt:           user.UpdatedAt,
+	}
+	for _, passkey := range user.Passkeys {
+		profile.Passkeys = append(profile.Passkeys, exportPasskey{
+			Name:       passkey.Name,
+			CreatedAt:  passkey.CreatedAt,
+			LastUsedAt: passkey.LastUsedAt,
+		})
+	}
+	return profile
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"pwa/pkg/jwt"
+	"time"
+)
+
+const defaultImpersonationTTL = 30 * time.Minute
+
+var (
+	ErrImpersonationTargetNotFound = errors.New("user not found")
+	ErrCannotImpersonate           = errors.New("admins and your own account cannot be impersonated")
+	ErrImpersonationNotFound       = errors.New("impersonation session not found")
+)
+
+// Impersonation is an impersonation session as shown to the impersonated
+// user.
+type Impersonation struct {
+	models.Session
+	ActorUsername string `json:"actorUsername,omitempty"`
+}
+
+type ImpersonationService struct {
+	sessions *repository.SessionRepository
+	users    *repository.UserRepository
+	audit    *repository.AuditLogRepository
+	ttl      time.Duration
+}
+
+// NewImpersonationService builds the service. Impersonation tokens last
+// IMPERSONATION_TTL (default 30m) and cannot be refreshed.
+func NewImpersonationService(sessions *repository.SessionRepository, users *repository.UserRepository, audit *repository.AuditLogRepository) *ImpersonationService {
+	return &ImpersonationService{
+		sessions: sessions,
+		users:    users,
+		audit:    audit,
+		ttl:      envconfig.Duration("IMPERSONATION_TTL", defaultImpersonationTTL),
+	}
+}
+
+// Start opens an impersonation session on the target's account and returns
+// an access token for it.
+func (s *ImpersonationService) Start(ctx context.Context, actorID primitive.ObjectID, targetID, reason string, info models.SessionInfo) (TokenPair, error) {
+	if !primitive.IsValidObjectID(targetID) {
+		return TokenPair{}, ErrImpersonationTargetNotFound
+	}
+	target, err := s.users.FindUserByID(ctx, targetID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, ErrImpersonationTargetNotFound
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+	if target.ID == actorID || target.GlobalRole() == models.RoleAdmin {
+		return TokenPair{}, ErrCannotImpersonate
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     target.ID,
+		ActorID:    &actorID,
+		Reason:     reason,
+		DeviceName: info.DeviceName,
+		UserAgent:  info.UserAgent,
+		IP:         info.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  &expiresAt,
+	}
+	if _, err := s.sessions.CreateSession(ctx, session); err != nil {
+		return TokenPair{}, err
+	}
+
+	token, err := jwt.GenerateImpersonationToken(target.ID.Hex(), session.ID.Hex(), target.GlobalRole(), actorID.Hex(), s.ttl)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	log.Printf("Admin %s started impersonating user %s: %s", actorID.Hex(), target.ID.Hex(), reason)
+	return TokenPair{AccessToken: token, ExpiresIn: int64(s.ttl.Seconds())}, nil
+}
+
+// Record adds a request made in an impersonation session to the audit log.
+func (s *ImpersonationService) Record(ctx context.Context, entry models.AuditLogEntry) error {
+	entry.CreatedAt = time.Now()
+	_, err := s.audit.CreateEntry(ctx, entry)
+	return err
+}
+
+// List returns every impersonation session opened on the user's account.
+func (s *ImpersonationService) List(ctx context.Context, userID primitive.ObjectID) ([]Impersonation, error) {
+	sessions, err := s.sessions.FindImpersonationsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make(map[primitive.ObjectID]string)
+	impersonations := make([]Impersonation, 0, len(sessions))
+	for _, session := range sessions {
+		actorID := *session.ActorID
+		if _, ok := usernames[actorID]; !ok {
+			if actor, err := s.users.FindUserByID(ctx, actorID.Hex()); err == nil {
+				usernames[actorID] = actor.Username
+			} else {
+				usernames[actorID] = ""
+			}
+		}
+		impersonations = append(impersonations, Impersonation{Session: session, ActorUsername: usernames[actorID]})
+	}
+	return impersonations, nil
+}
+
+// Requests returns the audit log of one impersonation session on the
+// user's account.
+func (s *ImpersonationService) Requests(ctx context.Context, userID primitive.ObjectID, sessionID string) ([]models.AuditLogEntry, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, ErrImpersonationNotFound
+	}
+	entries, err := s.audit.FindBySession(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []models.AuditLogEntry{}
+	}
+	return entries, nil
+}
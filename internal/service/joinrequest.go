@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"time"
+)
+
+var (
+	ErrJoinRequestPending  = errors.New("a join request for this channel is already pending")
+	ErrJoinRequestNotFound = errors.New("pending join request not found")
+	ErrInvalidJoinStatus   = errors.New("invalid join request status")
+	ErrRequesterBanned     = errors.New("the requester is banned from this channel")
+)
+
+type JoinRequestService struct {
+	requests *repository.JoinRequestRepository
+	channels *repository.ChannelRepository
+	users    *repository.UserRepository
+	push     *WebPushService
+}
+
+// NewJoinRequestService builds the service. push may be nil, in which case
+// nobody is notified about requests and decisions.
+func NewJoinRequestService(requests *repository.JoinRequestRepository, channels *repository.ChannelRepository, users *repository.UserRepository, push *WebPushService) *JoinRequestService {
+	return &JoinRequestService{requests: requests, channels: channels, users: users, push: push}
+}
+
+// Request files a join request for the channel and notifies its owner and
+// admins.
+func (s *JoinRequestService) Request(ctx context.Context, channel models.Channel, userID primitive.ObjectID, message string) (models.JoinRequest, error) {
+	if channel.MemberRole(userID.Hex()) != "" {
+		return models.JoinRequest{}, ErrAlreadyChannelMember
+	}
+	if channel.IsBanned(userID.Hex()) {
+		return models.JoinRequest{}, ErrChannelBanned
+	}
+
+	request := models.JoinRequest{
+		ID:        primitive.NewObjectID(),
+		ChannelID: channel.ID,
+		UserID:    userID,
+		Message:   message,
+		Status:    models.JoinRequestPending,
+		CreatedAt: time.Now(),
+	}
+	created, err := s.requests.CreateJoinRequest(ctx, request)
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+	if !created {
+		return models.JoinRequest{}, ErrJoinRequestPending
+	}
+
+	name := "Someone"
+	if user, err := s.users.FindUserByID(ctx, userID.Hex()); err == nil {
+		name = user.Username
+	}
+	text := fmt.Sprintf("%s asked to join '%s'.", name, channel.Name)
+	for _, member := range channel.MemberList() {
+		if models.ChannelRoleAllows(member.Role, models.PermissionManageMembers) {
+			s.notify(ctx, member.UserID, text)
+		}
+	}
+	return request, nil
+}
+
+// List returns the channel's join requests with the given status, or all
+// of them when status is empty.
+func (s *JoinRequestService) List(ctx context.Context, channelID primitive.ObjectID, status string) ([]models.JoinRequest, error) {
+	switch status {
+	case "", models.JoinRequestPending, models.JoinRequestApproved, models.JoinRequestDenied, models.JoinRequestCancelled:
+	default:
+		return nil, ErrInvalidJoinStatus
+	}
+
+	requests, err := s.requests.FindJoinRequests(ctx, channelID, status)
+	if err != nil {
+		return nil, err
+	}
+	if requests == nil {
+		requests = []models.JoinRequest{}
+	}
+	return requests, nil
+}
+
+// Decide approves or denies a pending request and notifies the requester.
+// Approved users join as members; requests of banned users can only be
+// denied.
+func (s *JoinRequestService) Decide(ctx context.Context, channel models.Channel, requestID string, deciderID primitive.ObjectID, approve bool) (models.JoinRequest, error) {
+	id, err := primitive.ObjectIDFromHex(requestID)
+	if err != nil {
+		return models.JoinRequest{}, ErrJoinRequestNotFound
+	}
+
+	status := models.JoinRequestDenied
+	if approve {
+		if request, err := s.requests.FindJoinRequest(ctx, channel.ID, id); err == nil && channel.IsBanned(request.UserID.Hex()) {
+			return request, ErrRequesterBanned
+		}
+		status = models.JoinRequestApproved
+	}
+	request, err := s.requests.DecideJoinRequest(ctx, channel.ID, id, status, deciderID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return request, ErrJoinRequestNotFound
+	} else if err != nil {
+		return request, err
+	}
+
+	if approve {
+		err := s.channels.JoinChannel(ctx, channel.ID.Hex(), request.UserID.Hex(), models.ChannelRoleMember)
+		if errors.Is(err, repository.ErrChannelNotJoined) {
+			err = joinRejection(ctx, s.channels, channel.ID.Hex(), request.UserID.Hex())
+			switch {
+			case errors.Is(err, ErrAlreadyChannelMember):
+				// They got in some other way; the approval stands.
+				err = nil
+			case errors.Is(err, ErrChannelBanned):
+				err = ErrRequesterBanned
+			}
+		}
+		if err != nil {
+			if err := s.requests.ReopenJoinRequest(ctx, request.ID); err != nil {
+				log.Printf("Failed to reopen join request %s: %v", request.ID.Hex(), err)
+			}
+			return request, err
+		}
+	}
+
+	s.notify(ctx, request.UserID.Hex(), fmt.Sprintf("Your request to join '%s' was %s.", channel.Name, status))
+	return request, nil
+}
+
+func (s *JoinRequestService) notify(ctx context.Context, userID, message string) {
+	if s.push == nil {
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+	if err := s.push.NotifyUser(ctx, uid, message); err != nil {
+		log.Printf("Failed to notify user %s: %v", userID, err)
+	}
+}
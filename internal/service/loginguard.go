@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/url"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"pwa/pkg/jwt"
+	"pwa/pkg/mailer"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLoginMaxFailures   = 5
+	defaultLoginIPMaxFailures = 50
+	defaultLoginFailureWindow = 15 * time.Minute
+	defaultLoginLockout       = 15 * time.Minute
+
+	// loginFreeFailures is how many failures are allowed before each further
+	// attempt has to wait; the wait doubles per failure up to loginMaxDelay.
+	loginFreeFailures = 2
+	loginMaxDelay     = 30 * time.Second
+)
+
+var ErrInvalidUnlockToken = errors.New("invalid or expired unlock link")
+
+// LoginThrottledError is returned by LoginGuard.Check when an attempt must
+// not be evaluated yet.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, the account is temporarily locked"
+	}
+	return "too many failed login attempts, please wait before trying again"
+}
+
+// LoginAttempt describes one credential check. User is nil when the
+// identifier did not match any account.
+type LoginAttempt struct {
+	Identifier string
+	Method     string
+	User       *models.User
+	IP         string
+	UserAgent  string
+}
+
+func (a LoginAttempt) accountKey() string {
+	if a.User != nil {
+		return "user:" + a.User.ID.Hex()
+	}
+	return "identifier:" + strings.ToLower(strings.TrimSpace(a.Identifier))
+}
+
+func (a LoginAttempt) ipKey() string {
+	return "ip:" + a.IP
+}
+
+// LoginGuard slows down and locks out password guessing. Counters live in
+// MongoDB so every API instance sees the same state.
+type LoginGuard struct {
+	throttles     *repository.LoginThrottleRepository
+	events        *repository.LoginEventRepository
+	mailer        mailer.Mailer
+	maxFailures   int
+	ipMaxFailures int
+	window        time.Duration
+	lockout       time.Duration
+}
+
+// NewLoginGuard builds the guard. An account or unknown identifier is locked
+// for LOGIN_LOCKOUT_DURATION (default 15m) after LOGIN_MAX_FAILURES (default
+// 5) failures within LOGIN_FAILURE_WINDOW (default 15m); a client IP after
+// LOGIN_IP_MAX_FAILURES (default 50).
+func NewLoginGuard(throttles *repository.LoginThrottleRepository, events *repository.LoginEventRepository, m mailer.Mailer) *LoginGuard {
+	return &LoginGuard{
+		throttles:     throttles,
+		events:        events,
+		mailer:        m,
+		maxFailures:   envconfig.Int("LOGIN_MAX_FAILURES", defaultLoginMaxFailures),
+		ipMaxFailures: envconfig.Int("LOGIN_IP_MAX_FAILURES", defaultLoginIPMaxFailures),
+		window:        envconfig.Duration("LOGIN_FAILURE_WINDOW", defaultLoginFailureWindow),
+		lockout:       envconfig.Duration("LOGIN_LOCKOUT_DURATION", defaultLoginLockout),
+	}
+}
+
+// Check returns a *LoginThrottledError if the account or the client IP is
+// locked, or if the progressive delay since the last failure has not passed.
+func (g *LoginGuard) Check(ctx context.Context, attempt LoginAttempt) error {
+	accountKey := attempt.accountKey()
+	throttles, err := g.throttles.FindThrottles(ctx, []string{accountKey, attempt.ipKey()})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var throttled *LoginThrottledError
+	for _, throttle := range throttles {
+		var wait time.Duration
+		locked := false
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			wait, locked = throttle.LockedUntil.Sub(now), true
+		} else if throttle.Key == accountKey && now.Sub(throttle.LastFailureAt) < g.window {
+			wait = throttle.LastFailureAt.Add(loginDelay(throttle.Failures)).Sub(now)
+		}
+
+		if wait > 0 && (throttled == nil || wait > throttled.RetryAfter) {
+			throttled = &LoginThrottledError{RetryAfter: wait, Locked: locked}
+		}
+	}
+
+	if throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+// Failure records a failed attempt and locks the account or IP once it
+// crosses its limit. The account owner is mailed an unlock link the first
+// time their account gets locked.
+func (g *LoginGuard) Failure(ctx context.Context, attempt LoginAttempt, reason string) {
+	g.record(ctx, attempt, false, reason)
+
+	account, err := g.throttles.RecordFailure(ctx, attempt.accountKey(), attempt.IP, g.window)
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", attempt.accountKey(), err)
+	} else if account.Failures >= g.maxFailures {
+		locked, err := g.throttles.Lock(ctx, account.Key, time.Now().Add(g.lockout))
+		if err != nil {
+			log.Printf("Failed to lock %s: %v", account.Key, err)
+		} else if locked && attempt.User != nil {
+			if err := g.sendUnlockEmail(ctx, account.Key, *attempt.User); err != nil {
+				log.Printf("Failed to send unlock email to user %s: %v", attempt.User.ID.Hex(), err)
+			}
+		}
+	}
+
+	ip, err := g.throttles.RecordFailure(ctx, attempt.ipKey(), "", g.window)
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", attempt.ipKey(), err)
+	} else if ip.Failures >= g.ipMaxFailures {
+		if _, err := g.throttles.Lock(ctx, ip.Key, time.Now().Add(g.lockout)); err != nil {
+			log.Printf("Failed to lock %s: %v", ip.Key, err)
+		}
+	}
+}
+
+// Success records a completed login and clears the account's counter. The
+// IP counter is kept so one valid account cannot be used to reset it.
+func (g *LoginGuard) Success(ctx context.Context, attempt LoginAttempt) {
+	g.record(ctx, attempt, true, "")
+
+	if err := g.throttles.Reset(ctx, attempt.accountKey()); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", attempt.accountKey(), err)
+	}
+}
+
+// Unlock lifts the lockout of the account behind a mailed unlock link, and
+// of the client IPs the failed attempts came from. Each link works once.
+func (g *LoginGuard) Unlock(ctx context.Context, token string) error {
+	claims, err := jwt.ValidateAccountUnlockToken(token)
+	if err != nil || claims.ID == "" {
+		return ErrInvalidUnlockToken
+	}
+	if _, err := primitive.ObjectIDFromHex(claims.Subject); err != nil {
+		return ErrInvalidUnlockToken
+	}
+
+	throttle, err := g.throttles.ConsumeUnlock(ctx, "user:"+claims.Subject, claims.ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidUnlockToken
+	} else if err != nil {
+		return err
+	}
+	if len(throttle.IPs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(throttle.IPs))
+	for _, ip := range throttle.IPs {
+		keys = append(keys, LoginAttempt{IP: ip}.ipKey())
+	}
+	return g.throttles.Reset(ctx, keys...)
+}
+
+func (g *LoginGuard) sendUnlockEmail(ctx context.Context, key string, user models.User) error {
+	unlockID, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := g.throttles.SetUnlockID(ctx, key, unlockID); err != nil {
+		return err
+	}
+	token, err := jwt.GenerateAccountUnlockToken(user.ID.Hex(), unlockID)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/unlock-account?token=" + url.QueryEscape(token))
+	return g.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe locked your account for %s after several failed sign-in attempts. "+
+			"If these were you, open the link below to unlock it right away:\n\n%s\n\n"+
+			"If they weren't, consider resetting your password.\n", user.Username, g.lockout, link),
+	})
+}
+
+func (g *LoginGuard) record(ctx context.Context, attempt LoginAttempt, success bool, reason string) {
+	event := models.LoginEvent{
+		Identifier: attempt.Identifier,
+		Method:     attempt.Method,
+		Success:    success,
+		Reason:     reason,
+		IP:         attempt.IP,
+		UserAgent:  attempt.UserAgent,
+		CreatedAt:  time.Now(),
+	}
+	if attempt.User != nil {
+		event.UserID = &attempt.User.ID
+	}
+	if _, err := g.events.CreateEvent(ctx, event); err != nil {
+		log.Printf("Failed to record login event: %v", err)
+	}
+}
+
+// loginDelay is how long to wait after the given number of failures before
+// the next attempt is evaluated.
+func loginDelay(failures int) time.Duration {
+	if failures <= loginFreeFailures {
+		return 0
+	}
+	delay := time.Second << (failures - loginFreeFailures - 1)
+	if delay > loginMaxDelay || delay <= 0 {
+		return loginMaxDelay
+	}
+	return delay
+}
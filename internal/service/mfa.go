@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/totp"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// recoveryCodeBytes is the entropy of each recovery code. Codes are stored as
+// plain SHA-256 hashes, so they need to be long enough that a leaked hash
+// cannot be brute-forced.
+const recoveryCodeBytes = 10
+
+var (
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolling   = errors.New("no pending two-factor enrollment")
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+type MFAService struct {
+	users  *repository.UserRepository
+	issuer string
+}
+
+// NewMFAService builds the service. MFA_ISSUER names the app in
+// authenticator apps and defaults to "PWA".
+func NewMFAService(users *repository.UserRepository) *MFAService {
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "PWA"
+	}
+	return &MFAService{users: users, issuer: issuer}
+}
+
+// BeginEnrollment stores a fresh pending secret for the user. It only takes
+// effect once confirmed with a code from the authenticator app.
+func (s *MFAService) BeginEnrollment(ctx context.Context, user models.User) (TOTPEnrollment, error) {
+	if user.MFAEnabled() {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	ok, err := s.users.SetPendingTOTPSecret(ctx, user.ID, secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if !ok {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	return TOTPEnrollment{Secret: secret, URI: totp.URI(s.issuer, account, secret)}, nil
+}
+
+// ConfirmEnrollment enables TOTP when code matches the pending secret and
+// returns the plaintext recovery codes, which are never shown again.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, user models.User, code string) ([]string, error) {
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFA == nil || user.MFA.PendingTOTPSecret == "" {
+		return nil, ErrMFANotEnrolling
+	}
+
+	step, ok := totp.Validate(user.MFA.PendingTOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.EnableTOTP(ctx, user.ID, user.MFA.PendingTOTPSecret, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+func (s *MFAService) Verify(ctx context.Context, user models.User, code string) error {
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := totp.Validate(user.MFA.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.users.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.users.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Disable turns TOTP off after checking a code, so a stolen session alone
+// cannot remove the second factor.
+func (s *MFAService) Disable(ctx context.Context, user models.User, code string) error {
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+	return s.users.DisableMFA(ctx, user.ID)
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes[i] = raw[:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
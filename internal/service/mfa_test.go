@@ -0,0 +1,22 @@
+package service
+
+import "testing"
+
+func TestRecoveryCodesMatchTheirHashes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	for i, code := range codes {
+		raw := normalizeRecoveryCode(code)
+		if len(raw)*5 < recoveryCodeBytes*8 {
+			t.Fatalf("code %q carries fewer than %d bits", code, recoveryCodeBytes*8)
+		}
+		if hashToken(normalizeRecoveryCode(" "+code+" ")) != hashes[i] {
+			t.Fatalf("code %q does not match its stored hash", code)
+		}
+	}
+}
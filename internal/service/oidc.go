@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/oidc"
+	"strings"
+	"time"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrOIDCStateNotFound     = errors.New("unknown or expired login state")
+	ErrOIDCFailed            = errors.New("identity provider login failed")
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists but its email is not verified; log in and verify it first")
+)
+
+// OIDCUserStore is the part of the user repository the OIDC service needs.
+type OIDCUserStore interface {
+	CreateUser(ctx context.Context, user models.User) (*mongo.InsertOneResult, error)
+	FindUserByIdentifier(ctx context.Context, identifier string) (models.User, error)
+	FindUserByEmail(ctx context.Context, email string) (models.User, error)
+	FindUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	AddIdentity(ctx context.Context, id primitive.ObjectID, identity models.ExternalIdentity) error
+}
+
+// OIDCStateStore keeps login state between the redirect to the provider
+// and the callback. ConsumeState returns mongo.ErrNoDocuments for unknown or
+// expired states.
+type OIDCStateStore interface {
+	CreateState(ctx context.Context, state models.OIDCLoginState) (*mongo.InsertOneResult, error)
+	ConsumeState(ctx context.Context, state string) (models.OIDCLoginState, error)
+}
+
+var (
+	_ OIDCUserStore  = (*repository.UserRepository)(nil)
+	_ OIDCStateStore = (*repository.OIDCStateRepository)(nil)
+)
+
+type OIDCService struct {
+	provider     *oidc.Provider
+	users        OIDCUserStore
+	states       OIDCStateStore
+	registration *RegistrationService
+}
+
+// OIDCConfigFromEnv reads OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET,
+// OIDC_REDIRECT_URL and the optional space separated OIDC_SCOPES.
+func OIDCConfigFromEnv() (oidc.Config, error) {
+	config := oidc.Config{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return config, fmt.Errorf("OIDC_ISSUER, OIDC_CLIENT_ID and OIDC_REDIRECT_URL must be set")
+	}
+	return config, nil
+}
+
+func NewOIDCService(provider *oidc.Provider, users OIDCUserStore, states OIDCStateStore, registration *RegistrationService) *OIDCService {
+	return &OIDCService{provider: provider, users: users, states: states, registration: registration}
+}
+
+// BeginLogin stores a fresh state, nonce and PKCE verifier and returns the
+// provider URL the browser should be sent to.
+func (s *OIDCService) BeginLogin(ctx context.Context) (string, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.states.CreateState(ctx, models.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// FinishLogin redeems the authorization code and resolves the local user:
+// an already linked account, an account with the same verified email, or a
+// newly created one. Accounts are only created while registration is open.
+func (s *OIDCService) FinishLogin(ctx context.Context, state, code string) (models.User, error) {
+	loginState, err := s.states.ConsumeState(ctx, state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, ErrOIDCStateNotFound
+	} else if err != nil {
+		return models.User{}, err
+	}
+
+	token, err := s.provider.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+	claims, err := s.provider.VerifyIDToken(ctx, token.IDToken, loginState.Nonce)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+
+	issuer := s.provider.Issuer()
+	user, err := s.users.FindUserByIdentity(ctx, issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, err
+	}
+
+	identity := models.ExternalIdentity{
+		Issuer:   issuer,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+
+	if claims.Email != "" && bool(claims.EmailVerified) {
+		user, err := s.users.FindUserByEmail(ctx, claims.Email)
+		if err == nil {
+			// Linking to an unverified account would let whoever registered
+			// the address first keep access through their password.
+			if !user.Verified {
+				return models.User{}, ErrOIDCAccountUnverified
+			}
+			if err := s.users.AddIdentity(ctx, user.ID, identity); err != nil {
+				return models.User{}, err
+			}
+			return user, nil
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.User{}, err
+		}
+	}
+
+	return s.createUser(ctx, claims, identity)
+}
+
+func (s *OIDCService) createUser(ctx context.Context, claims *oidc.IDTokenClaims, identity models.ExternalIdentity) (models.User, error) {
+	if s.registration.Mode() != models.RegistrationOpen {
+		return models.User{}, ErrRegistrationClosed
+	}
+
+	now := time.Now()
+	user := models.User{
+		Email:      claims.Email,
+		Role:       models.RoleUser,
+		Verified:   claims.Email != "" && bool(claims.EmailVerified),
+		Identities: []models.ExternalIdentity{identity},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if user.Verified {
+		user.VerifiedAt = &now
+	}
+
+	base := usernameFromClaims(claims)
+	for attempt := 0; attempt < 5; attempt++ {
+		user.ID = primitive.NewObjectID()
+		user.Username = base
+		if attempt > 0 {
+			suffix := make([]byte, 2)
+			if _, err := rand.Read(suffix); err != nil {
+				return models.User{}, err
+			}
+			user.Username = base + "-" + hex.EncodeToString(suffix)
+		}
+
+		if _, err := s.users.FindUserByIdentifier(ctx, user.Username); err == nil {
+			continue
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.User{}, err
+		}
+
+		_, err := s.users.CreateUser(ctx, user)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err != nil {
+			return models.User{}, err
+		}
+		return user, nil
+	}
+	return models.User{}, fmt.Errorf("could not find a free username for %q", base)
+}
+
+func usernameFromClaims(claims *oidc.IDTokenClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" && claims.Email != "" {
+		candidate = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pwa/internal/models"
+	"pwa/pkg/oidc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "pwa-test"
+
+type memoryOIDCUsers struct {
+	users []models.User
+}
+
+func (m *memoryOIDCUsers) CreateUser(_ context.Context, user models.User) (*mongo.InsertOneResult, error) {
+	m.users = append(m.users, user)
+	return &mongo.InsertOneResult{InsertedID: user.ID}, nil
+}
+
+func (m *memoryOIDCUsers) FindUserByIdentifier(_ context.Context, identifier string) (models.User, error) {
+	for _, user := range m.users {
+		if user.Username == identifier || user.Email == identifier {
+			return user, nil
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryOIDCUsers) FindUserByEmail(_ context.Context, email string) (models.User, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryOIDCUsers) FindUserByIdentity(_ context.Context, issuer, subject string) (models.User, error) {
+	for _, user := range m.users {
+		for _, identity := range user.Identities {
+			if identity.Issuer == issuer && identity.Subject == subject {
+				return user, nil
+			}
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryOIDCUsers) AddIdentity(_ context.Context, id primitive.ObjectID, identity models.ExternalIdentity) error {
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].Identities = append(m.users[i].Identities, identity)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+type memoryOIDCStates struct {
+	states map[string]models.OIDCLoginState
+}
+
+func (m *memoryOIDCStates) CreateState(_ context.Context, state models.OIDCLoginState) (*mongo.InsertOneResult, error) {
+	m.states[state.State] = state
+	return &mongo.InsertOneResult{}, nil
+}
+
+func (m *memoryOIDCStates) ConsumeState(_ context.Context, state string) (models.OIDCLoginState, error) {
+	loginState, ok := m.states[state]
+	if !ok || time.Now().After(loginState.ExpiresAt) {
+		return models.OIDCLoginState{}, mongo.ErrNoDocuments
+	}
+	delete(m.states, state)
+	return loginState, nil
+}
+
+// mockProvider is an OpenID Connect provider on httptest. Codes are handed
+// out by authorize, which plays the part of the user signing in, and are
+// only redeemed together with the matching PKCE verifier.
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// authorize follows the authorization URL as the user's browser would and
+// returns the code and state the provider redirects back with.
+func (p *mockProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, p.server.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization URL %q", authURL)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %v", query)
+	}
+
+	code, err = oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.codes[code] = mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"access_token": "at", "token_type": "Bearer", "id_token": idToken, "expires_in": 60})
+}
+
+func newTestOIDCService(t *testing.T, users *memoryOIDCUsers) (*OIDCService, *mockProvider) {
+	t.Helper()
+	mock := newMockProvider(t)
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      mock.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://example.com/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		HTTPClient:  mock.server.Client(),
+	})
+	states := &memoryOIDCStates{states: map[string]models.OIDCLoginState{}}
+	return NewOIDCService(provider, users, states, NewRegistrationService(models.RegistrationOpen, nil, nil)), mock
+}
+
+func oidcLogin(t *testing.T, service *OIDCService, mock *mockProvider, claims jwt.MapClaims) (models.User, error) {
+	t.Helper()
+	authURL, err := service.BeginLogin(context.Background())
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	code, state := mock.authorize(t, authURL, claims)
+	return service.FinishLogin(context.Background(), state, code)
+}
+
+func TestOIDCLoginCreatesAndLinksAccount(t *testing.T) {
+	users := &memoryOIDCUsers{}
+	service, mock := newTestOIDCService(t, users)
+	claims := jwt.MapClaims{
+		"sub":                "subject-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "Alice",
+	}
+
+	created, err := oidcLogin(t, service, mock, claims)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if created.Username != "alice" || !created.Verified || len(users.users) != 1 {
+		t.Fatalf("unexpected account %+v", created)
+	}
+
+	again, err := oidcLogin(t, service, mock, claims)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again.ID != created.ID || len(users.users) != 1 {
+		t.Fatalf("second login resolved to %s, want %s", again.ID.Hex(), created.ID.Hex())
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccountByEmail(t *testing.T) {
+	existing := models.User{ID: primitive.NewObjectID(), Username: "bob", Email: "bob@example.com", Verified: true}
+	users := &memoryOIDCUsers{users: []models.User{existing}}
+	service, mock := newTestOIDCService(t, users)
+
+	user, err := oidcLogin(t, service, mock, jwt.MapClaims{"sub": "subject-2", "email": "bob@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if user.ID != existing.ID || len(users.users[0].Identities) != 1 {
+		t.Fatalf("identity was not linked to the existing account")
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedAccount(t *testing.T) {
+	existing := models.User{ID: primitive.NewObjectID(), Username: "carol", Email: "carol@example.com"}
+	users := &memoryOIDCUsers{users: []models.User{existing}}
+	service, mock := newTestOIDCService(t, users)
+
+	_, err := oidcLogin(t, service, mock, jwt.MapClaims{"sub": "subject-3", "email": "carol@example.com", "email_verified": true})
+	if !errors.Is(err, ErrOIDCAccountUnverified) {
+		t.Fatalf("got %v, want ErrOIDCAccountUnverified", err)
+	}
+	if len(users.users[0].Identities) != 0 {
+		t.Fatalf("identity was linked to an unverified account")
+	}
+}
+
+func TestOIDCLoginRejectsUnknownState(t *testing.T) {
+	service, mock := newTestOIDCService(t, &memoryOIDCUsers{})
+	authURL, err := service.BeginLogin(context.Background())
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	code, _ := mock.authorize(t, authURL, jwt.MapClaims{"sub": "subject-4"})
+
+	if _, err := service.FinishLogin(context.Background(), "forged-state", code); !errors.Is(err, ErrOIDCStateNotFound) {
+		t.Fatalf("got %v, want ErrOIDCStateNotFound", err)
+	}
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	service, mock := newTestOIDCService(t, &memoryOIDCUsers{})
+
+	_, err := oidcLogin(t, service, mock, jwt.MapClaims{"sub": "subject-5", "nonce": "replayed"})
+	if !errors.Is(err, ErrOIDCFailed) {
+		t.Fatalf("got %v, want ErrOIDCFailed", err)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/url"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/envconfig"
+	"pwa/pkg/mailer"
+	"pwa/pkg/passwordhash"
+	"pwa/pkg/passwordpolicy"
+	"time"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordResetService struct {
+	users  *repository.UserRepository
+	resets *repository.PasswordResetRepository
+	tokens *TokenService
+	mailer mailer.Mailer
+	policy *passwordpolicy.Policy
+	ttl    time.Duration
+}
+
+// NewPasswordResetService builds the service. Reset links stay valid for
+// PASSWORD_RESET_TTL (default one hour).
+func NewPasswordResetService(users *repository.UserRepository, resets *repository.PasswordResetRepository, tokens *TokenService, m mailer.Mailer, policy *passwordpolicy.Policy) *PasswordResetService {
+	return &PasswordResetService{
+		users:  users,
+		resets: resets,
+		tokens: tokens,
+		mailer: m,
+		policy: policy,
+		ttl:    envconfig.Duration("PASSWORD_RESET_TTL", defaultPasswordResetTTL),
+	}
+}
+
+// RequestReset mails a reset link to the account matching identifier. It
+// returns nil for unknown accounts so callers cannot probe for users.
+func (s *PasswordResetService) RequestReset(ctx context.Context, identifier string) error {
+	user, err := s.users.FindUserByIdentifier(ctx, identifier)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.resets.InvalidateUserTokens(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = s.resets.CreateResetToken(ctx, models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/reset-password?token=" + url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. "+
+			"Open the link below within %s to choose a new one:\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n", user.Username, s.ttl, link),
+	})
+}
+
+// ResetPassword sets a new password using a mailed token and signs the user
+// out of every session. A password rejected by the policy is reported as a
+// *passwordpolicy.Error and leaves the token usable.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, password string) error {
+	pending, err := s.resets.FindResetToken(ctx, hashToken(token))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+
+	user, err := s.users.FindUserByID(ctx, pending.UserID.Hex())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+	if err := s.policy.Check(password, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	reset, err := s.resets.ConsumeResetToken(ctx, hashToken(token))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+
+	hashedPassword, err := passwordhash.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": reset.UserID}
+	update := bson.M{"$set": bson.M{"password": hashedPassword, "updatedAt": time.Now()}}
+	if _, err := s.users.UpdateUser(ctx, filter, update); err != nil {
+		return err
+	}
+
+	if err := s.tokens.RevokeAll(ctx, reset.UserID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset for user %s: %v", reset.UserID.Hex(), err)
+	}
+	return nil
+}
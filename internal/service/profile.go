@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"golang.org/x/text/language"
+	"io"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/avatar"
+	"pwa/pkg/envconfig"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultAvatarMaxBytes = 5 << 20
+	defaultAvatarSize     = 256
+	maxDisplayNameLength  = 64
+	maxProfileBatch       = 100
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 50
+	maxDirectoryQuery     = 64
+)
+
+var (
+	ErrProfileNotFound    = errors.New("user not found")
+	ErrAvatarNotFound     = errors.New("avatar not found")
+	ErrInvalidDisplayName = errors.New("display name must be at most 64 characters without control characters")
+	ErrInvalidTimezone    = errors.New("timezone must be an IANA time zone name such as Europe/Paris")
+	ErrInvalidLocale      = errors.New("locale must be a BCP 47 language tag such as en-US")
+	ErrTooManyProfiles    = errors.New("at most 100 profiles can be requested at once")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidQuery       = errors.New("search query must be at most 64 characters")
+)
+
+// directoryCursor is the position after the last user of a directory page,
+// handed to clients as opaque base64.
+type directoryCursor struct {
+	Username string             `json:"u"`
+	ID       primitive.ObjectID `json:"id"`
+}
+
+type ProfileService struct {
+	users    *repository.UserRepository
+	avatars  *repository.AvatarRepository
+	maxBytes int64
+	size     int
+}
+
+// NewProfileService builds the service. Avatar uploads are limited to
+// AVATAR_MAX_BYTES (default 5 MiB) and stored as AVATAR_SIZE pixel squares
+// (default 256).
+func NewProfileService(users *repository.UserRepository, avatars *repository.AvatarRepository) *ProfileService {
+	return &ProfileService{
+		users:    users,
+		avatars:  avatars,
+		maxBytes: int64(envconfig.Int("AVATAR_MAX_BYTES", defaultAvatarMaxBytes)),
+		size:     envconfig.Int("AVATAR_SIZE", defaultAvatarSize),
+	}
+}
+
+func (s *ProfileService) Get(ctx context.Context, userID primitive.ObjectID) (models.Profile, error) {
+	user, err := s.find(ctx, userID.Hex())
+	if err != nil {
+		return models.Profile{}, err
+	}
+	return user.Profile(), nil
+}
+
+// Update validates and stores the given profile fields. The locale is
+// stored in its canonical form.
+func (s *ProfileService) Update(ctx context.Context, userID primitive.ObjectID, request models.UpdateProfileRequest) (models.Profile, error) {
+	set := bson.M{"updatedAt": time.Now()}
+	unset := bson.M{}
+	field := func(name, value string) {
+		if value == "" {
+			unset[name] = ""
+		} else {
+			set[name] = value
+		}
+	}
+
+	if request.DisplayName != nil {
+		name := strings.TrimSpace(*request.DisplayName)
+		if !validDisplayName(name) {
+			return models.Profile{}, ErrInvalidDisplayName
+		}
+		field("displayName", name)
+	}
+	if request.Timezone != nil {
+		timezone := strings.TrimSpace(*request.Timezone)
+		if timezone != "" && !validTimezone(timezone) {
+			return models.Profile{}, ErrInvalidTimezone
+		}
+		field("timezone", timezone)
+	}
+	if request.Locale != nil {
+		locale := strings.TrimSpace(*request.Locale)
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil || tag == language.Und {
+				return models.Profile{}, ErrInvalidLocale
+			}
+			locale = tag.String()
+		}
+		field("locale", locale)
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := s.users.UpdateUser(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Profile{}, ErrProfileNotFound
+	}
+	return s.Get(ctx, userID)
+}
+
+// SetAvatar processes an uploaded image and makes it the user's avatar,
+// removing the previous one. Invalid uploads are reported with the errors
+// of package avatar.
+func (s *ProfileService) SetAvatar(ctx context.Context, userID primitive.ObjectID, upload io.Reader) (models.Profile, error) {
+	image, err := avatar.Process(upload, s.maxBytes, s.size)
+	if err != nil {
+		return models.Profile{}, err
+	}
+
+	fileID, err := s.avatars.UploadAvatar(userID, avatar.ContentType, bytes.NewReader(image))
+	if err != nil {
+		return models.Profile{}, err
+	}
+	previous, err := s.users.SetAvatar(ctx, userID, &fileID)
+	if err != nil {
+		if err := s.avatars.DeleteAvatar(ctx, fileID); err != nil {
+			log.Printf("Failed to delete orphaned avatar %s: %v", fileID.Hex(), err)
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Profile{}, ErrProfileNotFound
+		}
+		return models.Profile{}, err
+	}
+	s.deleteAvatar(ctx, previous)
+	return s.Get(ctx, userID)
+}
+
+func (s *ProfileService) RemoveAvatar(ctx context.Context, userID primitive.ObjectID) error {
+	previous, err := s.users.SetAvatar(ctx, userID, nil)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrProfileNotFound
+	} else if err != nil {
+		return err
+	}
+	s.deleteAvatar(ctx, previous)
+	return nil
+}
+
+// OpenAvatar returns the current avatar of the user with the given hex ID.
+// The caller must close the stream.
+func (s *ProfileService) OpenAvatar(ctx context.Context, userID string) (*gridfs.DownloadStream, error) {
+	user, err := s.find(ctx, userID)
+	if errors.Is(err, ErrProfileNotFound) || (err == nil && user.AvatarID == nil) {
+		return nil, ErrAvatarNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	stream, err := s.avatars.OpenAvatar(*user.AvatarID)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrAvatarNotFound
+	}
+	return stream, err
+}
+
+// PublicProfile returns what other users may see of the account with the
+// given hex ID.
+func (s *ProfileService) PublicProfile(ctx context.Context, userID string) (models.PublicProfile, error) {
+	user, err := s.find(ctx, userID)
+	if err != nil {
+		return models.PublicProfile{}, err
+	}
+	return user.PublicProfile(), nil
+}
+
+// PublicProfiles looks up several accounts at once, e.g. the members of a
+// channel. Unknown IDs are skipped.
+func (s *ProfileService) PublicProfiles(ctx context.Context, userIDs []string) ([]models.PublicProfile, error) {
+	if len(userIDs) > maxProfileBatch {
+		return nil, ErrTooManyProfiles
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if id, err := primitive.ObjectIDFromHex(userID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []models.PublicProfile{}, nil
+	}
+
+	users, err := s.users.FindUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]models.PublicProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.PublicProfile())
+	}
+	return profiles, nil
+}
+
+// Directory returns a page of public profiles whose username or display
+// name starts with query. limit is clamped to 1..50, defaulting to 20 when
+// zero or negative.
+func (s *ProfileService) Directory(ctx context.Context, query, cursor string, limit int) (models.DirectoryPage, error) {
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) > maxDirectoryQuery {
+		return models.DirectoryPage{}, ErrInvalidQuery
+	}
+	if limit <= 0 {
+		limit = defaultDirectoryLimit
+	}
+	limit = min(limit, maxDirectoryLimit)
+
+	var after directoryCursor
+	if cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || json.Unmarshal(raw, &after) != nil || after.Username == "" {
+			return models.DirectoryPage{}, ErrInvalidCursor
+		}
+	}
+
+	// One extra user tells whether another page follows.
+	users, err := s.users.FindDirectoryPage(ctx, query, after.Username, after.ID, int64(limit)+1)
+	if err != nil {
+		return models.DirectoryPage{}, err
+	}
+
+	page := models.DirectoryPage{Users: make([]models.PublicProfile, 0, limit)}
+	for i, user := range users {
+		if i == limit {
+			last := users[limit-1]
+			raw, err := json.Marshal(directoryCursor{Username: last.Username, ID: last.ID})
+			if err != nil {
+				return models.DirectoryPage{}, err
+			}
+			page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+			break
+		}
+		page.Users = append(page.Users, user.PublicProfile())
+	}
+	return page, nil
+}
+
+func (s *ProfileService) find(ctx context.Context, userID string) (models.User, error) {
+	if !primitive.IsValidObjectID(userID) {
+		return models.User{}, ErrProfileNotFound
+	}
+	user, err := s.users.FindUserByID(ctx, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, ErrProfileNotFound
+	}
+	return user, err
+}
+
+func (s *ProfileService) deleteAvatar(ctx context.Context, fileID *primitive.ObjectID) {
+	if fileID == nil {
+		return
+	}
+	if err := s.avatars.DeleteAvatar(ctx, *fileID); err != nil {
+		log.Printf("Failed to delete replaced avatar %s: %v", fileID.Hex(), err)
+	}
+}
+
+func validDisplayName(name string) bool {
+	if utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validTimezone accepts IANA zone names. "Local" is refused because it
+// names the server's zone, not one the user can mean.
+func validTimezone(name string) bool {
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"strings"
+	"time"
+)
+
+// InviteCodePrefix marks invite codes so they are recognisable when pasted.
+const InviteCodePrefix = "pwa_inv_"
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInviteCodeRequired = errors.New("an invite code is required to register")
+	ErrInvalidInviteCode  = errors.New("invalid, expired or used up invite code")
+	ErrInviteCodeNotFound = errors.New("invite code not found")
+	ErrInvalidInvite      = errors.New("invalid invite code settings")
+)
+
+type RegistrationService struct {
+	mode     string
+	invites  *repository.InviteCodeRepository
+	channels *repository.ChannelRepository
+}
+
+// RegistrationModeFromEnv reads REGISTRATION_MODE, which is one of open
+// (the default), invite_only or closed.
+func RegistrationModeFromEnv() (string, error) {
+	mode := strings.TrimSpace(os.Getenv("REGISTRATION_MODE"))
+	switch mode {
+	case "":
+		return models.RegistrationOpen, nil
+	case models.RegistrationOpen, models.RegistrationInviteOnly, models.RegistrationClosed:
+		return mode, nil
+	}
+	return "", fmt.Errorf("REGISTRATION_MODE must be %s, %s or %s, got %q",
+		models.RegistrationOpen, models.RegistrationInviteOnly, models.RegistrationClosed, mode)
+}
+
+func NewRegistrationService(mode string, invites *repository.InviteCodeRepository, channels *repository.ChannelRepository) *RegistrationService {
+	return &RegistrationService{mode: mode, invites: invites, channels: channels}
+}
+
+func (s *RegistrationService) Mode() string {
+	return s.mode
+}
+
+// Admit decides whether an account may be created for email. In invite-only
+// mode it takes one use of the code and returns the invite, which must be
+// passed to Complete or Abort afterwards. A code given in open mode is
+// ignored.
+func (s *RegistrationService) Admit(ctx context.Context, email, code string) (*models.InviteCode, error) {
+	switch s.mode {
+	case models.RegistrationClosed:
+		return nil, ErrRegistrationClosed
+	case models.RegistrationOpen:
+		return nil, nil
+	}
+
+	if code == "" {
+		return nil, ErrInviteCodeRequired
+	}
+	invite, err := s.invites.UseInviteCode(ctx, hashToken(code), strings.ToLower(email))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidInviteCode
+	} else if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// Complete adds the new user to the channels the invite pre-assigns.
+// Channels deleted or archived since the invite was created are skipped.
+func (s *RegistrationService) Complete(ctx context.Context, invite *models.InviteCode, userID primitive.ObjectID) {
+	if invite == nil {
+		return
+	}
+	for _, channelID := range invite.ChannelIDs {
+		err := s.channels.JoinChannel(ctx, channelID.Hex(), userID.Hex(), models.ChannelRoleMember)
+		if errors.Is(err, repository.ErrChannelNotJoined) {
+			err = joinRejection(ctx, s.channels, channelID.Hex(), userID.Hex())
+		}
+		if err != nil {
+			log.Printf("Failed to add user %s to channel %s from invite %s: %v", userID.Hex(), channelID.Hex(), invite.ID.Hex(), err)
+		}
+	}
+}
+
+// Abort gives back the use Admit took when the account could not be
+// created.
+func (s *RegistrationService) Abort(ctx context.Context, invite *models.InviteCode) {
+	if invite == nil {
+		return
+	}
+	if err := s.invites.ReleaseInviteCode(ctx, invite.ID); err != nil {
+		log.Printf("Failed to release invite code %s: %v", invite.ID.Hex(), err)
+	}
+}
+
+// CreateInvite issues a code. The plaintext code is only returned here and
+// cannot be recovered later.
+func (s *RegistrationService) CreateInvite(ctx context.Context, adminID primitive.ObjectID, request models.CreateInviteCodeRequest) (models.InviteCode, string, error) {
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return models.InviteCode{}, "", fmt.Errorf("%w: expiry must be in the future", ErrInvalidInvite)
+	}
+	maxUses := request.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+
+	channelIDs := make([]primitive.ObjectID, 0, len(request.ChannelIDs))
+	for _, id := range request.ChannelIDs {
+		channel, err := s.channels.FindChannelByID(ctx, id)
+		if err != nil {
+			return models.InviteCode{}, "", fmt.Errorf("%w: unknown channel %q", ErrInvalidInvite, id)
+		}
+		channelIDs = append(channelIDs, channel.ID)
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return models.InviteCode{}, "", err
+	}
+	code := InviteCodePrefix + secret
+
+	invite := models.InviteCode{
+		ID:         primitive.NewObjectID(),
+		CodeHash:   hashToken(code),
+		Prefix:     code[:len(InviteCodePrefix)+4],
+		Email:      strings.ToLower(request.Email),
+		MaxUses:    maxUses,
+		ChannelIDs: channelIDs,
+		CreatedBy:  adminID,
+		ExpiresAt:  request.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+	if _, err := s.invites.CreateInviteCode(ctx, invite); err != nil {
+		return models.InviteCode{}, "", err
+	}
+	return invite, code, nil
+}
+
+func (s *RegistrationService) ListInvites(ctx context.Context) ([]models.InviteCode, error) {
+	invites, err := s.invites.FindInviteCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if invites == nil {
+		invites = []models.InviteCode{}
+	}
+	return invites, nil
+}
+
+func (s *RegistrationService) RevokeInvite(ctx context.Context, inviteID string) error {
+	id, err := primitive.ObjectIDFromHex(inviteID)
+	if err != nil {
+		return ErrInviteCodeNotFound
+	}
+	ok, err := s.invites.RevokeInviteCode(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInviteCodeNotFound
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/jwt"
+	"time"
+)
+
+// recentLoginWindow is how long after signing in a session may confirm
+// sensitive actions on accounts that have no password to ask for.
+const recentLoginWindow = 10 * time.Minute
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+type TokenService struct {
+	refreshTokens *repository.RefreshTokenRepository
+	sessions      *repository.SessionRepository
+	users         *repository.UserRepository
+	accessTokens  *repository.AccessTokenRepository
+}
+
+func NewTokenService(refreshTokens *repository.RefreshTokenRepository, sessions *repository.SessionRepository, users *repository.UserRepository, accessTokens *repository.AccessTokenRepository) *TokenService {
+	return &TokenService{refreshTokens: refreshTokens, sessions: sessions, users: users, accessTokens: accessTokens}
+}
+
+// Issue creates a new session for the user, e.g. on login. The session ID
+// doubles as the refresh token family ID.
+func (s *TokenService) Issue(ctx context.Context, userID string, info models.SessionInfo) (TokenPair, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     uid,
+		DeviceName: info.DeviceName,
+		UserAgent:  info.UserAgent,
+		IP:         info.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if _, err := s.sessions.CreateSession(ctx, session); err != nil {
+		return TokenPair{}, err
+	}
+
+	return s.issue(ctx, userID, session.ID.Hex())
+}
+
+// Refresh rotates the given refresh token. Presenting a token that was
+// already rotated revokes its whole family, logging out every holder. The
+// new access token carries the user's current role.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string, info models.SessionInfo) (TokenPair, error) {
+	token, err := s.refreshTokens.FindByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+
+	if token.RevokedAt != nil {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	ok, err := s.refreshTokens.MarkUsed(ctx, token.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !ok {
+		log.Printf("Refresh token reuse detected for user %s, revoking session %s", token.UserID.Hex(), token.FamilyID)
+		if err := s.revokeSession(ctx, token.UserID, token.FamilyID); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessions.FindActiveSession(ctx, token.FamilyID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.sessions.Touch(ctx, session.ID, info.IP, info.UserAgent); err != nil {
+		log.Printf("Failed to update session %s: %v", session.ID.Hex(), err)
+	}
+
+	return s.issue(ctx, token.UserID.Hex(), token.FamilyID)
+}
+
+// Revoke ends the session the refresh token belongs to.
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := s.refreshTokens.FindByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidRefreshToken
+	} else if err != nil {
+		return err
+	}
+	return s.revokeSession(ctx, token.UserID, token.FamilyID)
+}
+
+// RevokeSession ends one of the user's sessions, e.g. a lost device.
+func (s *TokenService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	sid, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	ok, err := s.sessions.RevokeSession(ctx, sid, uid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return s.refreshTokens.RevokeFamily(ctx, sessionID)
+}
+
+// RecentlySignedIn reports whether the session was started by a login
+// within the last few minutes. Refreshing tokens does not count.
+func (s *TokenService) RecentlySignedIn(ctx context.Context, sessionID string) (bool, error) {
+	session, err := s.sessions.FindActiveSession(ctx, sessionID)
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return time.Since(session.CreatedAt) < recentLoginWindow, nil
+}
+
+// RevokeAll signs the user out everywhere, e.g. after a password reset,
+// and revokes their personal access tokens.
+func (s *TokenService) RevokeAll(ctx context.Context, userID primitive.ObjectID) error {
+	if err := s.sessions.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.accessTokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.refreshTokens.RevokeUserTokens(ctx, userID)
+}
+
+func (s *TokenService) revokeSession(ctx context.Context, userID primitive.ObjectID, sessionID string) error {
+	if sid, err := primitive.ObjectIDFromHex(sessionID); err == nil {
+		if _, err := s.sessions.RevokeSession(ctx, sid, userID); err != nil {
+			return err
+		}
+	}
+	return s.refreshTokens.RevokeFamily(ctx, sessionID)
+}
+
+func (s *TokenService) issue(ctx context.Context, userID, familyID string) (TokenPair, error) {
+	user, err := s.users.FindUserByID(ctx, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+	uid := user.ID
+
+	accessToken, err := jwt.GenerateToken(userID, familyID, user.GlobalRole())
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	_, err = s.refreshTokens.CreateRefreshToken(ctx, models.RefreshToken{
+		UserID:    uid,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(jwt.RefreshTokenTTL()),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwt.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"pwa/pkg/jwt"
+	"pwa/pkg/mailer"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+	ErrAlreadyVerified          = errors.New("email address is already verified")
+)
+
+type EmailVerificationService struct {
+	users  *repository.UserRepository
+	mailer mailer.Mailer
+}
+
+func NewEmailVerificationService(users *repository.UserRepository, m mailer.Mailer) *EmailVerificationService {
+	return &EmailVerificationService{users: users, mailer: m}
+}
+
+// SendVerification mails a signed link confirming the user's current email.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user models.User) error {
+	if user.Verified {
+		return ErrAlreadyVerified
+	}
+
+	token, err := jwt.GenerateEmailVerificationToken(user.ID.Hex(), user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/verify-email?token=" + url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n", user.Username, link),
+	})
+}
+
+// Verify marks the account behind a verification link as verified.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	claims, err := jwt.ValidateEmailVerificationToken(token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	ok, err := s.users.MarkEmailVerified(ctx, userID, claims.Email)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"log"
+	"os"
+	"pwa/internal/models"
+	"pwa/internal/repository"
+	"strings"
+	"time"
+)
+
+const webAuthnChallengeTTL = 5 * time.Minute
+
+var (
+	ErrWebAuthnChallengeNotFound = errors.New("unknown or expired WebAuthn challenge")
+	ErrWebAuthnFailed            = errors.New("WebAuthn verification failed")
+)
+
+// webAuthnUser adapts models.User to webauthn.User. The user handle is the
+// raw ObjectID, which carries no personal data.
+type webAuthnUser struct {
+	user models.User
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	if u.user.Email != "" {
+		return u.user.Email
+	}
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.user.Passkeys))
+	for _, passkey := range u.user.Passkeys {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(passkey.Transports))
+		for _, t := range passkey.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              passkey.ID,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   passkey.UserVerified,
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       passkey.AAGUID,
+				SignCount:    passkey.SignCount,
+				CloneWarning: passkey.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
+
+// WebAuthnUserStore is the part of the user repository the WebAuthn
+// service needs.
+type WebAuthnUserStore interface {
+	FindUserByID(ctx context.Context, id string) (models.User, error)
+	AddPasskey(ctx context.Context, id primitive.ObjectID, credential models.WebAuthnCredential) error
+	RecordPasskeyUse(ctx context.Context, id primitive.ObjectID, credentialID []byte, signCount uint32, cloneWarning bool) error
+}
+
+// WebAuthnChallengeStore keeps ceremony state between the begin and finish
+// requests. ConsumeChallenge returns mongo.ErrNoDocuments for unknown or
+// expired challenges.
+type WebAuthnChallengeStore interface {
+	CreateChallenge(ctx context.Context, challenge models.WebAuthnChallenge) (*mongo.InsertOneResult, error)
+	ConsumeChallenge(ctx context.Context, id, ceremony string) (models.WebAuthnChallenge, error)
+}
+
+var (
+	_ WebAuthnUserStore      = (*repository.UserRepository)(nil)
+	_ WebAuthnChallengeStore = (*repository.WebAuthnChallengeRepository)(nil)
+)
+
+type WebAuthnService struct {
+	webAuthn   *webauthn.WebAuthn
+	users      WebAuthnUserStore
+	challenges WebAuthnChallengeStore
+}
+
+// WebAuthnConfigFromEnv reads the relying party from WEBAUTHN_RP_ID,
+// WEBAUTHN_RP_ORIGINS (comma separated) and WEBAUTHN_RP_NAME.
+func WebAuthnConfigFromEnv() (*webauthn.Config, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	origins := os.Getenv("WEBAUTHN_RP_ORIGINS")
+	if rpID == "" || origins == "" {
+		return nil, fmt.Errorf("WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS must be set")
+	}
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = "PWA"
+	}
+	return &webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: name,
+		RPOrigins:     strings.Split(origins, ","),
+	}, nil
+}
+
+func NewWebAuthnService(config *webauthn.Config, users WebAuthnUserStore, challenges WebAuthnChallengeStore) (*WebAuthnService, error) {
+	w, err := webauthn.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnService{webAuthn: w, users: users, challenges: challenges}, nil
+}
+
+// BeginRegistration returns the creation options for a new discoverable
+// credential and the ID of the challenge to finish it with.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, user models.User) (*protocol.CredentialCreation, string, error) {
+	wUser := webAuthnUser{user: user}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.Passkeys))
+	for _, credential := range wUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(wUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := s.storeChallenge(ctx, models.WebAuthnCeremonyRegistration, &user.ID, *session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, id, nil
+}
+
+// FinishRegistration verifies the authenticator's attestation response
+// (the JSON-encoded PublicKeyCredential) and stores the new passkey.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, user models.User, challengeID, name string, response io.Reader) (models.WebAuthnCredential, error) {
+	challenge, err := s.consumeChallenge(ctx, challengeID, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	if challenge.UserID == nil || *challenge.UserID != user.ID {
+		return models.WebAuthnCredential{}, ErrWebAuthnChallengeNotFound
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+	credential, err := s.webAuthn.CreateCredential(webAuthnUser{user: user}, challenge.Session, parsed)
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	passkey := models.WebAuthnCredential{
+		ID:              credential.ID,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.users.AddPasskey(ctx, user.ID, passkey); err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	return passkey, nil
+}
+
+// BeginLogin starts a usernameless login: the authenticator picks the
+// passkey and reveals the user through its user handle.
+func (s *WebAuthnService) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := s.storeChallenge(ctx, models.WebAuthnCeremonyLogin, nil, *session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, id, nil
+}
+
+// FinishLogin verifies the assertion response and returns the user owning
+// the passkey.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, challengeID string, response io.Reader) (models.User, error) {
+	challenge, err := s.consumeChallenge(ctx, challengeID, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	var user models.User
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != len(primitive.ObjectID{}) {
+			return nil, fmt.Errorf("invalid user handle")
+		}
+		var id primitive.ObjectID
+		copy(id[:], userHandle)
+		found, err := s.users.FindUserByID(ctx, id.Hex())
+		if err != nil {
+			return nil, err
+		}
+		for _, passkey := range found.Passkeys {
+			if bytes.Equal(passkey.ID, rawID) {
+				user = found
+				return webAuthnUser{user: found}, nil
+			}
+		}
+		return nil, fmt.Errorf("credential does not belong to user")
+	}, challenge.Session, parsed)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Printf("Passkey signature counter did not increase for user %s, possible cloned authenticator", user.ID.Hex())
+	}
+	if err := s.users.RecordPasskeyUse(ctx, user.ID, credential.ID, credential.Authenticator.SignCount, credential.Authenticator.CloneWarning); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (s *WebAuthnService) storeChallenge(ctx context.Context, ceremony string, userID *primitive.ObjectID, session webauthn.SessionData) (string, error) {
+	challenge := models.WebAuthnChallenge{
+		ID:        primitive.NewObjectID(),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Session:   session,
+		ExpiresAt: time.Now().Add(webAuthnChallengeTTL),
+	}
+	if _, err := s.challenges.CreateChallenge(ctx, challenge); err != nil {
+		return "", err
+	}
+	return challenge.ID.Hex(), nil
+}
+
+func (s *WebAuthnService) consumeChallenge(ctx context.Context, id, ceremony string) (models.WebAuthnChallenge, error) {
+	challenge, err := s.challenges.ConsumeChallenge(ctx, id, ceremony)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return challenge, ErrWebAuthnChallengeNotFound
+	}
+	return challenge, err
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pwa/internal/models"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+type memoryWebAuthnUsers struct {
+	users map[primitive.ObjectID]models.User
+}
+
+func (m *memoryWebAuthnUsers) FindUserByID(_ context.Context, id string) (models.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, err
+	}
+	user, ok := m.users[oid]
+	if !ok {
+		return models.User{}, mongo.ErrNoDocuments
+	}
+	return user, nil
+}
+
+func (m *memoryWebAuthnUsers) AddPasskey(_ context.Context, id primitive.ObjectID, credential models.WebAuthnCredential) error {
+	user := m.users[id]
+	user.Passkeys = append(user.Passkeys, credential)
+	m.users[id] = user
+	return nil
+}
+
+func (m *memoryWebAuthnUsers) RecordPasskeyUse(_ context.Context, id primitive.ObjectID, credentialID []byte, signCount uint32, cloneWarning bool) error {
+	user := m.users[id]
+	for i := range user.Passkeys {
+		if bytes.Equal(user.Passkeys[i].ID, credentialID) {
+			user.Passkeys[i].SignCount = signCount
+			user.Passkeys[i].CloneWarning = cloneWarning
+		}
+	}
+	m.users[id] = user
+	return nil
+}
+
+type memoryWebAuthnChallenges struct {
+	challenges map[string]models.WebAuthnChallenge
+}
+
+func (m *memoryWebAuthnChallenges) CreateChallenge(_ context.Context, challenge models.WebAuthnChallenge) (*mongo.InsertOneResult, error) {
+	m.challenges[challenge.ID.Hex()] = challenge
+	return &mongo.InsertOneResult{InsertedID: challenge.ID}, nil
+}
+
+func (m *memoryWebAuthnChallenges) ConsumeChallenge(_ context.Context, id, ceremony string) (models.WebAuthnChallenge, error) {
+	challenge, ok := m.challenges[id]
+	if !ok || challenge.Ceremony != ceremony {
+		return models.WebAuthnChallenge{}, mongo.ErrNoDocuments
+	}
+	delete(m.challenges, id)
+	return challenge, nil
+}
+
+// softAuthenticator is a minimal platform authenticator holding one P-256
+// passkey and producing "none" attestations.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) create(creation *protocol.CredentialCreation) []byte {
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(a.clientData("webauthn.create", creation.Response.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+func (a *softAuthenticator) get(assertion *protocol.CredentialAssertion) []byte {
+	a.signCount++
+	authData := a.authData(0x05, nil)
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]string) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return body
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestWebAuthnService(t *testing.T) (*WebAuthnService, *memoryWebAuthnUsers, models.User) {
+	user := models.User{ID: primitive.NewObjectID(), Username: "alice", Email: "alice@example.com"}
+	users := &memoryWebAuthnUsers{users: map[primitive.ObjectID]models.User{user.ID: user}}
+	challenges := &memoryWebAuthnChallenges{challenges: map[string]models.WebAuthnChallenge{}}
+	service, err := NewWebAuthnService(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "PWA",
+		RPOrigins:     []string{testOrigin},
+	}, users, challenges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, users, user
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	service, users, user := newTestWebAuthnService(t)
+	authenticator := newSoftAuthenticator(t)
+
+	creation, challengeID, err := service.BeginRegistration(ctx, user)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	passkey, err := service.FinishRegistration(ctx, user, challengeID, "Laptop", bytes.NewReader(authenticator.create(creation)))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if passkey.Name != "Laptop" || !bytes.Equal(passkey.ID, authenticator.credentialID) {
+		t.Fatalf("unexpected passkey %+v", passkey)
+	}
+	if got := len(users.users[user.ID].Passkeys); got != 1 {
+		t.Fatalf("stored %d passkeys, want 1", got)
+	}
+
+	assertion, challengeID, err := service.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	loggedIn, err := service.FinishLogin(ctx, challengeID, bytes.NewReader(authenticator.get(assertion)))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Fatalf("logged in as %s, want %s", loggedIn.ID.Hex(), user.ID.Hex())
+	}
+	if got := users.users[user.ID].Passkeys[0].SignCount; got != 1 {
+		t.Fatalf("sign count %d, want 1", got)
+	}
+
+	if _, err := service.FinishLogin(ctx, challengeID, bytes.NewReader(authenticator.get(assertion))); !errors.Is(err, ErrWebAuthnChallengeNotFound) {
+		t.Fatalf("replayed challenge: got %v, want %v", err, ErrWebAuthnChallengeNotFound)
+	}
+}
+
+func TestWebAuthnLoginRejectsUnknownPasskey(t *testing.T) {
+	ctx := context.Background()
+	service, _, user := newTestWebAuthnService(t)
+
+	creation, challengeID, err := service.BeginRegistration(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := newSoftAuthenticator(t)
+	if _, err := service.FinishRegistration(ctx, user, challengeID, "", bytes.NewReader(registered.create(creation))); err != nil {
+		t.Fatal(err)
+	}
+
+	stranger := newSoftAuthenticator(t)
+	stranger.userHandle = registered.userHandle
+	assertion, challengeID, err := service.BeginLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishLogin(ctx, challengeID, bytes.NewReader(stranger.get(assertion))); err == nil {
+		t.Fatal("login with an unregistered passkey succeeded")
+	}
+}
@@ -0,0 +1,85 @@
+// Package avatar validates uploaded profile pictures and normalizes them to
+// a square PNG of a fixed size.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+// ContentType is the type of every processed avatar.
+const ContentType = "image/png"
+
+// maxPixels bounds the decoded size of an upload so a small, highly
+// compressed file cannot exhaust memory.
+const maxPixels = 40_000_000
+
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("unsupported image type; use JPEG, PNG, GIF or WebP")
+	ErrInvalidImage    = errors.New("image could not be decoded")
+)
+
+// allowedTypes are the content types accepted, as sniffed from the data
+// rather than taken from the client.
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Process reads at most maxBytes from r, checks that the data really is a
+// supported image and returns it center-cropped and resized to size×size
+// and re-encoded as PNG. Re-encoding also drops any embedded metadata.
+func Process(r io.Reader, maxBytes int64, size int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	if !allowedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, squareCrop(src.Bounds()), draw.Src, nil)
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, dst); err != nil {
+		return nil, fmt.Errorf("encode avatar: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// squareCrop returns the largest square centered in bounds.
+func squareCrop(bounds image.Rectangle) image.Rectangle {
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
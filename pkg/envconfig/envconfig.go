@@ -0,0 +1,48 @@
+// Package envconfig reads optional settings from the environment, falling
+// back to a default when a variable is unset or invalid.
+package envconfig
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Duration parses key as a positive time.Duration such as "15m".
+func Duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using default %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// Int parses key as a positive integer.
+func Int(key string, fallback int) int {
+	return intAtLeast(key, fallback, 1)
+}
+
+// IntAllowZero parses key as a non-negative integer, for settings where 0
+// turns a check off.
+func IntAllowZero(key string, fallback int) int {
+	return intAtLeast(key, fallback, 0)
+}
+
+func intAtLeast(key string, fallback, min int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		log.Printf("Invalid %s %q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
@@ -4,9 +4,30 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"os"
+	"pwa/pkg/envconfig"
 	"time"
 )
 
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	mfaPendingTokenTTL     = 5 * time.Minute
+	emailVerifyTokenTTL    = 48 * time.Hour
+	accountUnlockTokenTTL  = 24 * time.Hour
+)
+
+// TokenTypeMFAPending marks tokens that only prove the password step of a
+// two-step login. They are never accepted as access tokens.
+const TokenTypeMFAPending = "mfa_pending"
+
+// TokenTypeEmailVerify marks the signed token embedded in email
+// verification links.
+const TokenTypeEmailVerify = "email_verify"
+
+// TokenTypeAccountUnlock marks the signed token mailed to users whose
+// account was locked after too many failed logins.
+const TokenTypeAccountUnlock = "account_unlock"
+
 func getSigningKey() ([]byte, error) {
 	var mySigningKey = []byte(os.Getenv("JWT_SECRET"))
 	if len(mySigningKey) == 0 {
@@ -15,46 +36,119 @@ func getSigningKey() ([]byte, error) {
 	return mySigningKey, nil
 }
 
-func GenerateToken(userID string) (string, error) {
-	mySigningKey, err := getSigningKey()
+// AccessTokenTTL is the lifetime of tokens produced by GenerateToken,
+// configurable through JWT_ACCESS_TTL (e.g. "15m").
+func AccessTokenTTL() time.Duration {
+	return envconfig.Duration("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL is the lifetime of server-side refresh tokens,
+// configurable through JWT_REFRESH_TTL (e.g. "720h").
+func RefreshTokenTTL() time.Duration {
+	return envconfig.Duration("JWT_REFRESH_TTL", defaultRefreshTokenTTL)
+}
+
+// Claims are the claims carried by access tokens. ID (jti) is the hex ID of
+// the session the token was issued for. Type is empty for access tokens.
+// Actor is set when an admin acts as the subject.
+type Claims struct {
+	jwt.RegisteredClaims
+	Type  string       `json:"typ,omitempty"`
+	Email string       `json:"email,omitempty"`
+	Role  string       `json:"role,omitempty"`
+	Actor *ActorClaims `json:"act,omitempty"`
+}
+
+// ActorClaims is the RFC 8693 "act" claim naming who is acting on behalf of
+// the token subject.
+type ActorClaims struct {
+	Subject string `json:"sub"`
+}
+
+func GenerateToken(userID, sessionID, role string) (string, error) {
+	return sign(userID, sessionID, "", AccessTokenTTL(), Claims{Role: role})
+}
+
+// GenerateImpersonationToken issues an access token for userID that also
+// names actorID, the admin using it. It is not paired with a refresh token.
+func GenerateImpersonationToken(userID, sessionID, role, actorID string, ttl time.Duration) (string, error) {
+	return sign(userID, sessionID, "", ttl, Claims{Role: role, Actor: &ActorClaims{Subject: actorID}})
+}
+
+// GenerateMFAPendingToken issues the short-lived token returned by the
+// password step of a login when the user has two-factor authentication on.
+func GenerateMFAPendingToken(userID string) (string, error) {
+	return sign(userID, "", TokenTypeMFAPending, mfaPendingTokenTTL, Claims{})
+}
+
+// GenerateEmailVerificationToken signs the address being verified, so a link
+// stops working once the user changes their email.
+func GenerateEmailVerificationToken(userID, email string) (string, error) {
+	return sign(userID, "", TokenTypeEmailVerify, emailVerifyTokenTTL, Claims{Email: email})
+}
+
+// GenerateAccountUnlockToken signs a link that lifts a login lockout. id
+// (jti) lets the server accept the link only once.
+func GenerateAccountUnlockToken(userID, id string) (string, error) {
+	return sign(userID, id, TokenTypeAccountUnlock, accountUnlockTokenTTL, Claims{})
+}
+
+// sign issues a token of type typ for subject that expires after ttl. The
+// registered claims are filled in here; extra carries any other claims.
+func sign(subject, id, typ string, ttl time.Duration, extra Claims) (string, error) {
+	keyring, err := DefaultKeyring()
 	if err != nil {
 		return "", err
 	}
 
-	claims := &jwt.RegisteredClaims{
-		Subject:   userID,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	now := time.Now()
+	claims := extra
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        id,
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
+	claims.Type = typ
+	return keyring.Sign(&claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(mySigningKey)
-	if err != nil {
-		return "", err
-	}
+func ValidateToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, "")
+}
+
+func ValidateMFAPendingToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeMFAPending)
+}
+
+func ValidateEmailVerificationToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeEmailVerify)
+}
 
-	return tokenString, nil
+func ValidateAccountUnlockToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeAccountUnlock)
 }
 
-func ValidateToken(tokenString string) (string, error) {
-	mySigningKey, err := getSigningKey()
+func parseToken(tokenString, tokenType string) (*Claims, error) {
+	keyring, err := DefaultKeyring()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var opts []jwt.ParserOption
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
-		}
-		return mySigningKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyring.Keyfunc, opts...)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		return claims.Subject, nil
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Type == tokenType {
+		return claims, nil
 	} else {
-		return "", fmt.Errorf("invalid or expired token")
+		return nil, fmt.Errorf("invalid or expired token")
 	}
 }
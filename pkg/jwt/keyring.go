@@ -0,0 +1,300 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Key is a single entry of a Keyring. Retired keys have no private half and
+// are only used to verify tokens issued before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+func (k *Key) Retired() bool {
+	return k.private == nil
+}
+
+// Keyring holds every key tokens may be verified with and the one key new
+// tokens are signed with.
+type Keyring struct {
+	keys   map[string]*Key
+	active *Key
+	legacy *Key
+}
+
+// JSONWebKey is the public half of an asymmetric key as served from the
+// JWKS endpoint (RFC 7517).
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	defaultKeyringMu sync.Mutex
+	defaultKeyring   *Keyring
+)
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string]*Key{}}
+}
+
+// SetDefaultKeyring replaces the keyring used by GenerateToken and
+// ValidateToken.
+func SetDefaultKeyring(keyring *Keyring) {
+	defaultKeyringMu.Lock()
+	defer defaultKeyringMu.Unlock()
+	defaultKeyring = keyring
+}
+
+// DefaultKeyring returns the keyring set with SetDefaultKeyring, loading it
+// from the environment on first use.
+func DefaultKeyring() (*Keyring, error) {
+	defaultKeyringMu.Lock()
+	defer defaultKeyringMu.Unlock()
+	if defaultKeyring == nil {
+		keyring, err := LoadKeyringFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		defaultKeyring = keyring
+	}
+	return defaultKeyring, nil
+}
+
+// LoadKeyringFromEnv builds a keyring from JWT_KEYS_DIR and JWT_ACTIVE_KID.
+// When JWT_SECRET is also set, HS256 tokens issued before the switch to
+// asymmetric keys keep validating; without JWT_KEYS_DIR it is used to sign.
+func LoadKeyringFromEnv() (*Keyring, error) {
+	keyring := NewKeyring()
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		if err := keyring.LoadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if secret, err := getSigningKey(); err == nil {
+		keyring.legacy = &Key{Method: jwt.SigningMethodHS256, private: secret, public: secret}
+	}
+
+	if activeKID := os.Getenv("JWT_ACTIVE_KID"); activeKID != "" {
+		if err := keyring.SetActive(activeKID); err != nil {
+			return nil, err
+		}
+	} else if kid := keyring.newestSigningKID(); kid != "" {
+		if err := keyring.SetActive(kid); err != nil {
+			return nil, err
+		}
+	} else if keyring.legacy != nil {
+		keyring.active = keyring.legacy
+	}
+
+	if keyring.active == nil {
+		return nil, fmt.Errorf("no JWT signing key configured: set JWT_KEYS_DIR or JWT_SECRET")
+	}
+	return keyring, nil
+}
+
+// LoadDir adds every *.pem file in dir to the keyring, using the file name
+// without extension as the kid. PKCS#8 or PKCS#1 private keys (RSA or
+// Ed25519) can sign; PKIX public keys are loaded as retired keys. Keys can
+// be generated with e.g. `openssl genpkey -algorithm ed25519`.
+func (k *Keyring) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := ParsePEMKey(kid, data)
+		if err != nil {
+			return fmt.Errorf("failed to load JWT key %s: %w", file, err)
+		}
+		k.Add(key)
+	}
+	return nil
+}
+
+// ParsePEMKey parses an RSA or Ed25519 private or public key.
+func ParsePEMKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return NewKey(kid, key)
+	case ed25519.PrivateKey:
+		return NewKey(kid, key)
+	case *rsa.PublicKey:
+		return NewRetiredKey(kid, key)
+	case ed25519.PublicKey:
+		return NewRetiredKey(kid, key)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// NewKey wraps an RSA (RS256) or Ed25519 (EdDSA) private key.
+func NewKey(kid string, private crypto.Signer) (*Key, error) {
+	key, err := NewRetiredKey(kid, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = private
+	return key, nil
+}
+
+// NewRetiredKey wraps a public key that may only verify tokens.
+func NewRetiredKey(kid string, public crypto.PublicKey) (*Key, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("key ID must not be empty")
+	}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, public: public}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, public: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+func (k *Keyring) Add(key *Key) {
+	k.keys[key.ID] = key
+}
+
+// SetActive selects the key new tokens are signed with.
+func (k *Keyring) SetActive(kid string) error {
+	key, ok := k.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown JWT key %q", kid)
+	}
+	if key.Retired() {
+		return fmt.Errorf("JWT key %q is retired and cannot sign", kid)
+	}
+	k.active = key
+	return nil
+}
+
+// Sign signs the claims with the active key, setting the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	if k.active == nil {
+		return "", fmt.Errorf("no active JWT signing key")
+	}
+	token := jwt.NewWithClaims(k.active.Method, claims)
+	if k.active.ID != "" {
+		token.Header["kid"] = k.active.ID
+	}
+	return token.SignedString(k.active.private)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header.
+// Tokens without a kid are only accepted by the legacy HMAC secret.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	var key *Key
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = k.keys[kid]
+	} else {
+		key = k.legacy
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public halves of every key, retired ones included, so
+// tokens signed before a rotation can still be verified elsewhere.
+func (k *Keyring) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, kid := range k.sortedKIDs() {
+		key := k.keys[kid]
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (k *Keyring) sortedKIDs() []string {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
+// newestSigningKID picks the last non-retired kid in lexical order, so that
+// date-named key files rotate without touching JWT_ACTIVE_KID.
+func (k *Keyring) newestSigningKID() string {
+	kids := k.sortedKIDs()
+	for i := len(kids) - 1; i >= 0; i-- {
+		if !k.keys[kids[i]].Retired() {
+			return kids[i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text emails such as password reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv picks the implementation from MAILER: "smtp" uses the SMTP_*
+// variables, anything else (the default) writes to the outbox in
+// MAILER_OUTBOX_DIR, or to the log when that is unset.
+func NewFromEnv() (Mailer, error) {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return NewSMTPMailerFromEnv()
+	case "", "outbox":
+		return NewOutboxMailer(os.Getenv("MAILER_OUTBOX_DIR")), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", os.Getenv("MAILER"))
+	}
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
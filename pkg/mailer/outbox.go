@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const outboxFrom = "no-reply@localhost"
+
+// OutboxMailer never sends anything. It writes each message as an .eml file
+// into Dir, or logs it when Dir is empty, for local development and tests.
+type OutboxMailer struct {
+	Dir string
+}
+
+func NewOutboxMailer(dir string) *OutboxMailer {
+	return &OutboxMailer{Dir: dir}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data := format(outboxFrom, msg)
+	if m.Dir == "" {
+		log.Printf("Outbox mail:\n%s", data)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+)
+
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailerFromEnv reads SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM.
+func NewSMTPMailerFromEnv() (*SMTPMailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	from := os.Getenv("SMTP_FROM")
+	if host == "" || from == "" {
+		return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM must be set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(host, port),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
+
+// Send delivers the message, upgrading to TLS when the server offers
+// STARTTLS. net/smtp does not support cancellation, so ctx is only checked
+// before connecting.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, msg.To, format(m.From, msg))
+}
@@ -0,0 +1,41 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+)
+
+// illegalOperationCode is returned by standalone servers, which do not
+// support transactions.
+const illegalOperationCode = 20
+
+// WithTransaction runs fn inside a transaction. On deployments without
+// transaction support, such as a standalone development server, fn runs
+// once without one instead. fn may be retried and must be idempotent.
+func WithTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	if !transactionsUnsupported(err) {
+		return err
+	}
+
+	log.Printf("MongoDB does not support transactions here, running without one: %v", err)
+	return fn(ctx)
+}
+
+func transactionsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == illegalOperationCode
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Package passwordhash hashes passwords with argon2id and verifies both
+// argon2id and legacy bcrypt hashes, reporting when a stored hash should be
+// replaced by one made with the current parameters.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat is returned for stored hashes that are neither argon2id
+// nor bcrypt.
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Params are the argon2id cost parameters. Memory is in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendation of 19 MiB, two iterations
+// and one degree of parallelism.
+var DefaultParams = Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher hashes new passwords with its parameters.
+type Hasher struct {
+	params Params
+}
+
+func New(params Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+// ParamsFromEnv starts from DefaultParams and applies PASSWORD_ARGON2_MEMORY
+// (KiB), PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM.
+func ParamsFromEnv() (Params, error) {
+	params := DefaultParams
+	settings := []struct {
+		name string
+		max  uint64
+		set  func(uint64)
+	}{
+		{"PASSWORD_ARGON2_MEMORY", 1 << 22, func(v uint64) { params.Memory = uint32(v) }},
+		{"PASSWORD_ARGON2_ITERATIONS", 1 << 10, func(v uint64) { params.Iterations = uint32(v) }},
+		{"PASSWORD_ARGON2_PARALLELISM", 255, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+	for _, setting := range settings {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || n == 0 || n > setting.max {
+			return params, fmt.Errorf("%s must be a number between 1 and %d", setting.name, setting.max)
+		}
+		setting.set(n)
+	}
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return params, fmt.Errorf("PASSWORD_ARGON2_MEMORY must be at least 8 KiB per degree of parallelism")
+	}
+	return params, nil
+}
+
+// Hash returns an encoded argon2id hash in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches the stored hash and, if it does,
+// whether the hash should be replaced: bcrypt hashes and argon2id hashes
+// made with other parameters are.
+func (h *Hasher) Verify(password, hash string) (ok, rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decode(hash)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+		current := h.params
+		return true, params.Memory != current.Memory || params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism || params.KeyLength != current.KeyLength ||
+			params.SaltLength != current.SaltLength, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		} else if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+	return false, false, ErrUnknownFormat
+}
+
+func decode(hash string) (Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownFormat)
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+var (
+	defaultHasherMu sync.Mutex
+	defaultHasher   *Hasher
+)
+
+// SetDefault replaces the hasher used by Hash and Verify.
+func SetDefault(hasher *Hasher) {
+	defaultHasherMu.Lock()
+	defer defaultHasherMu.Unlock()
+	defaultHasher = hasher
+}
+
+// Default returns the hasher set with SetDefault, or one using
+// DefaultParams.
+func Default() *Hasher {
+	defaultHasherMu.Lock()
+	defer defaultHasherMu.Unlock()
+	if defaultHasher == nil {
+		defaultHasher = New(DefaultParams)
+	}
+	return defaultHasher
+}
+
+// Hash hashes password with the default hasher.
+func Hash(password string) (string, error) {
+	return Default().Hash(password)
+}
+
+// Verify checks password against hash with the default hasher.
+func Verify(password, hash string) (ok, rehash bool, err error) {
+	return Default().Verify(password, hash)
+}
@@ -0,0 +1,77 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of the SHA-1 hash that select
+// a bucket, as in the Pwned Passwords range API.
+const prefixLength = 5
+
+// BreachedList holds SHA-1 hashes of known breached passwords, grouped into
+// buckets by hash prefix so a lookup only searches one small bucket.
+type BreachedList struct {
+	buckets map[string][]string
+	count   int
+}
+
+// LoadBreachedFile reads one upper- or lower-case SHA-1 hex hash per line,
+// optionally followed by ":COUNT". Blank lines and lines starting with # are
+// skipped.
+func LoadBreachedFile(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{buckets: make(map[string][]string)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, line)
+		}
+		prefix := hash[:prefixLength]
+		list.buckets[prefix] = append(list.buckets[prefix], hash[prefixLength:])
+		list.count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.buckets {
+		sort.Strings(suffixes)
+	}
+	return list, nil
+}
+
+// Len returns the number of hashes loaded.
+func (l *BreachedList) Len() int {
+	return l.count
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes := l.buckets[hash[:prefixLength]]
+	suffix := hash[prefixLength:]
+	i := sort.SearchStrings(suffixes, suffix)
+	return i < len(suffixes) && suffixes[i] == suffix
+}
@@ -0,0 +1,134 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"pwa/pkg/envconfig"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMinLength = 8
+	defaultMinScore  = 2
+
+	// MaxLength bounds passwords so scoring and hashing stay cheap.
+	MaxLength = 128
+)
+
+// Rule names reported in a Violation.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleStrength         = "strength"
+	RuleContainsUsername = "contains_username"
+	RuleContainsEmail    = "contains_email"
+	RuleBreached         = "breached"
+)
+
+// Violation describes one rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is returned by Check and lists every rule the password failed.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+type Policy struct {
+	MinLength int
+	// MinScore is the lowest accepted Score, from 0 (anything goes) to 4.
+	MinScore int
+	// Breached is consulted when set.
+	Breached *BreachedList
+}
+
+// FromEnv reads PASSWORD_MIN_LENGTH (default 8), PASSWORD_MIN_SCORE
+// (default 2) and PASSWORD_BREACHED_FILE, a list of SHA-1 hashes in the
+// "HASH:COUNT" format of the Pwned Passwords downloads.
+func FromEnv() (*Policy, error) {
+	policy := &Policy{
+		MinLength: envconfig.IntAllowZero("PASSWORD_MIN_LENGTH", defaultMinLength),
+		MinScore:  envconfig.IntAllowZero("PASSWORD_MIN_SCORE", defaultMinScore),
+	}
+	if policy.MinScore > 4 {
+		policy.MinScore = 4
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		breached, err := LoadBreachedFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading breached passwords: %w", err)
+		}
+		log.Printf("Loaded %d breached password hashes from %s", breached.Len(), path)
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// Check validates password for the account with the given username and
+// email. It returns nil or an *Error.
+func (p *Policy) Check(password, username, email string) error {
+	if utf8.RuneCountInString(password) > MaxLength {
+		return &Error{Violations: []Violation{{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d characters long", MaxLength),
+		}}}
+	}
+
+	var violations []Violation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		violations = append(violations, Violation{Rule: RuleContainsUsername, Message: "must not contain your username"})
+	}
+	if local := emailLocalPart(email); local != "" && strings.Contains(lower, local) {
+		violations = append(violations, Violation{Rule: RuleContainsEmail, Message: "must not contain your email address"})
+	}
+
+	if p.MinScore > 0 && password != "" {
+		if score := Score(password, username, emailLocalPart(email)); score < p.MinScore {
+			violations = append(violations, Violation{
+				Rule:    RuleStrength,
+				Message: fmt.Sprintf("is too easy to guess (strength %d of 4, at least %d required)", score, p.MinScore),
+			})
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{Rule: RuleBreached, Message: "has appeared in a data breach"})
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// emailLocalPart returns the lower-cased part before the @, which is what
+// people tend to reuse in passwords.
+func emailLocalPart(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if len(local) < 3 {
+		return ""
+	}
+	return local
+}
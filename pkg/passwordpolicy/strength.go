@@ -0,0 +1,272 @@
+package passwordpolicy
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyboardRows are scanned for runs of adjacent keys such as "qwerty".
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "azertyuiop", "yxcvbnm"}
+
+var leetReplacer = strings.NewReplacer("4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i", "0", "o", "5", "s", "$", "s", "7", "t", "+", "t", "2", "z")
+
+// match is a substring [i, j) of the password that an attacker would guess
+// in about 10^guesses attempts.
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+// Score estimates how hard password is to guess, in the spirit of zxcvbn:
+// it looks for dictionary words (including the given user inputs, plain or
+// with l33t substitutions), sequences, repeats, keyboard runs and years, and
+// finds the cheapest way to assemble the password from them. The result is
+// 0 (trivial) to 4 (very strong).
+func Score(password string, userInputs ...string) int {
+	guesses := estimateGuesses([]rune(password), userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// estimateGuesses returns log10 of the estimated number of guesses.
+func estimateGuesses(password []rune, userInputs []string) float64 {
+	n := len(password)
+	if n == 0 {
+		return 0
+	}
+
+	matches := findMatches(password, userInputs)
+	byEnd := make(map[int][]match)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[j] is the cheapest cover of password[:j]; segments[j] counts the
+	// pattern matches it uses, which an attacker has to try in any order.
+	best := make([]float64, n+1)
+	segments := make([]int, n+1)
+	for j := 1; j <= n; j++ {
+		// Characters not covered by a pattern are brute-forced.
+		best[j] = best[j-1] + 1
+		segments[j] = segments[j-1]
+		for _, m := range byEnd[j] {
+			if cost := best[m.i] + m.guesses; cost < best[j] {
+				best[j] = cost
+				segments[j] = segments[m.i] + 1
+			}
+		}
+	}
+
+	return best[n] + log10Factorial(segments[n])
+}
+
+func findMatches(password []rune, userInputs []string) []match {
+	lower := []rune(strings.ToLower(string(password)))
+	var matches []match
+
+	// Substrings longer than the longest word (or a year) cannot match, so
+	// the scan stays linear in the password length.
+	longest := 4
+	dictionary := make(map[string]int, len(commonWords)+len(userInputs))
+	for rank, word := range commonWords {
+		dictionary[word] = rank + 1
+		longest = max(longest, utf8.RuneCountInString(word))
+	}
+	for _, input := range userInputs {
+		if input = strings.ToLower(input); len(input) >= 3 {
+			dictionary[input] = 1
+			longest = max(longest, utf8.RuneCountInString(input))
+		}
+	}
+
+	n := len(password)
+	for i := 0; i < n; i++ {
+		for j := i + 3; j <= min(n, i+longest); j++ {
+			word := string(lower[i:j])
+			variations := uppercaseVariations(password[i:j])
+			if rank, ok := dictionary[word]; ok {
+				matches = append(matches, match{i, j, math.Log10(float64(rank) * variations)})
+			}
+			if unleet := leetReplacer.Replace(word); unleet != word {
+				if rank, ok := dictionary[unleet]; ok {
+					matches = append(matches, match{i, j, math.Log10(float64(rank)*variations) + 1})
+				}
+			}
+			if isYear(word) {
+				matches = append(matches, match{i, j, math.Log10(120)})
+			}
+		}
+	}
+
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, repeatMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	return matches
+}
+
+// sequenceMatches finds runs like "abcd", "4321" or "mnop".
+func sequenceMatches(password []rune) []match {
+	var matches []match
+	n := len(password)
+	for i := 0; i < n-2; {
+		delta := password[i+1] - password[i]
+		if delta != 1 && delta != -1 {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < n && password[j]-password[j-1] == delta {
+			j++
+		}
+		if j-i >= 3 {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("az09", password[i]) || password[i] == '1':
+				base = 4
+			case unicode.IsDigit(password[i]):
+				base = 10
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{i, j, math.Log10(base * float64(j-i))})
+		}
+		i = j - 1
+	}
+	return matches
+}
+
+// repeatMatches finds runs of a repeated character or block, like "aaaa"
+// or "abcabc".
+func repeatMatches(password []rune) []match {
+	var matches []match
+	n := len(password)
+	for size := 1; size <= n/2; size++ {
+		for i := 0; i+2*size <= n; i++ {
+			j := i + size
+			for j+size <= n && slices.Equal(password[j:j+size], password[i:i+size]) {
+				j += size
+			}
+			count := (j - i) / size
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+			block := float64(size) * math.Log10(cardinality(password[i:i+size]))
+			matches = append(matches, match{i, j, block + math.Log10(float64(count))})
+		}
+	}
+	return matches
+}
+
+// keyboardMatches finds runs of at least four adjacent keys, forwards or
+// backwards. No run is longer than a keyboard row.
+func keyboardMatches(password []rune) []match {
+	var matches []match
+	n := len(password)
+	longest := 0
+	for _, row := range keyboardRows {
+		longest = max(longest, len(row))
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 4; j <= min(n, i+longest); j++ {
+			run := string(password[i:j])
+			for _, row := range keyboardRows {
+				if strings.Contains(row, run) || strings.Contains(reverse(row), run) {
+					matches = append(matches, match{i, j, math.Log10(20 * float64(j-i))})
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// uppercaseVariations is how many capitalisations of a word an attacker
+// tries before reaching this one.
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]):
+		return 2
+	default:
+		return math.Pow(2, float64(len(word)))
+	}
+}
+
+func cardinality(runes []rune) float64 {
+	var lower, upper, digit, other bool
+	for _, r := range runes {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	c := 0.0
+	if lower {
+		c += 26
+	}
+	if upper {
+		c += 26
+	}
+	if digit {
+		c += 10
+	}
+	if other {
+		c += 33
+	}
+	return c
+}
+
+func isYear(s string) bool {
+	if len(s) != 4 || !(strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func log10Factorial(n int) float64 {
+	f := 0.0
+	for i := 2; i <= n; i++ {
+		f += math.Log10(float64(i))
+	}
+	return f
+}